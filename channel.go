@@ -1,7 +1,14 @@
 package task
 
 import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/langhuihui/gotask/util"
 )
 
 // ITickTask 定时任务接口
@@ -28,10 +35,18 @@ func (t *ChannelTask) GetSignal() any {
 func (t *ChannelTask) Tick(any) {
 }
 
+const (
+	TickIntervalKey = "tickInterval"
+	PausedKey       = "paused"
+)
+
 // TickTask 定时任务
 type TickTask struct {
 	ChannelTask
-	Ticker *time.Ticker
+	Ticker   *time.Ticker
+	tickMux  sync.Mutex
+	interval time.Duration // SetTickInterval 设置的间隔，为 0 时使用 GetTickInterval
+	paused   bool
 }
 
 func (t *TickTask) GetTicker() *time.Ticker {
@@ -42,8 +57,57 @@ func (t *TickTask) GetTickInterval() time.Duration {
 	return time.Second
 }
 
+// SetTickInterval 修改定时器间隔，运行中立即生效，暂停时在恢复后生效
+// interval 为 0 时恢复使用 GetTickInterval，负值被忽略
+func (t *TickTask) SetTickInterval(interval time.Duration) {
+	if interval < 0 {
+		t.Warn("ignore negative tick interval", "interval", interval, "taskId", t.ID)
+		return
+	}
+	t.tickMux.Lock()
+	defer t.tickMux.Unlock()
+	t.interval = interval
+	interval = t.tickInterval()
+	t.SetDescription(TickIntervalKey, interval.String())
+	if t.Ticker != nil && !t.paused {
+		t.Ticker.Reset(interval)
+	}
+}
+
+// OnPause 任务暂停时停止定时器，暂停期间不再触发 Tick
+func (t *TickTask) OnPause() {
+	t.tickMux.Lock()
+	defer t.tickMux.Unlock()
+	t.paused = true
+	if t.Ticker != nil {
+		t.Ticker.Stop()
+	}
+}
+
+// OnResume 任务恢复时重启定时器，从恢复时刻起重新计时
+func (t *TickTask) OnResume() {
+	t.tickMux.Lock()
+	defer t.tickMux.Unlock()
+	t.paused = false
+	if t.Ticker != nil {
+		t.Ticker.Reset(t.tickInterval())
+	}
+}
+
+func (t *TickTask) tickInterval() time.Duration {
+	if t.interval > 0 {
+		return t.interval
+	}
+	return t.handler.(ITickTask).GetTickInterval()
+}
+
 func (t *TickTask) Start() (err error) {
-	t.Ticker = time.NewTicker(t.handler.(ITickTask).GetTickInterval())
+	t.tickMux.Lock()
+	interval := t.tickInterval()
+	t.Ticker = time.NewTicker(interval)
+	t.paused = false
+	t.tickMux.Unlock()
+	t.SetDescription(TickIntervalKey, interval.String())
 	t.SignalChan = t.Ticker.C
 	t.OnStop(func() {
 		t.Ticker.Reset(time.Millisecond)
@@ -51,23 +115,137 @@ func (t *TickTask) Start() (err error) {
 	return
 }
 
+const (
+	TICK_OVERLAP_QUEUE_ONE  TickOverlapPolicy = iota // Tick 运行中时最多排队一次，其余跳过
+	TICK_OVERLAP_SKIP                                // Tick 运行中时跳过
+	TICK_OVERLAP_CONCURRENT                          // 并发运行，最多 MaxConcurrency 个
+)
+
+const (
+	TickSkippedKey  = "tickSkipped"
+	TickDelayedKey  = "tickDelayed"
+	TickDurationKey = "tickDuration"
+)
+
+// TickOverlapPolicy Tick 耗时超过定时器间隔时的处理策略
+// 无论哪种策略，每次 Tick 都在新的 goroutine 中运行，包括零值 TICK_OVERLAP_QUEUE_ONE
+type TickOverlapPolicy byte
+
 // AsyncTickTask 异步定时任务
 type AsyncTickTask struct {
 	TickTask
+	Overlap        TickOverlapPolicy
+	MaxConcurrency int // TICK_OVERLAP_CONCURRENT 下的最大并发数，0 表示不限制
+	overlapMux     sync.Mutex
+	running        int
+	pending        bool
+	pendingValue   any
+	ticks          sync.WaitGroup
+	skipped        atomic.Uint64
+	delayed        atomic.Uint64
+	duration       Singleton[*util.Histogram] // 首次使用时创建，重试和重启后继续累计
+}
+
+func (p TickOverlapPolicy) String() string {
+	switch p {
+	case TICK_OVERLAP_SKIP:
+		return "skip"
+	case TICK_OVERLAP_CONCURRENT:
+		return "concurrent"
+	default:
+		return "queue-one"
+	}
 }
 
 func (t *AsyncTickTask) GetSignal() any {
 	return t.Task.GetSignal()
 }
 
+// SetOverlapPolicy 设置 Tick 重叠策略，maxConcurrency 仅对 TICK_OVERLAP_CONCURRENT 生效
+func (t *AsyncTickTask) SetOverlapPolicy(policy TickOverlapPolicy, maxConcurrency int) {
+	t.overlapMux.Lock()
+	defer t.overlapMux.Unlock()
+	t.Overlap, t.MaxConcurrency = policy, maxConcurrency
+}
+
+// SkippedTicks 获取因重叠被跳过的 Tick 次数
+func (t *AsyncTickTask) SkippedTicks() uint64 {
+	return t.skipped.Load()
+}
+
+// DelayedTicks 获取因重叠排队后延迟执行的 Tick 次数
+func (t *AsyncTickTask) DelayedTicks() uint64 {
+	return t.delayed.Load()
+}
+
+// TickDuration 获取 Tick 耗时分布，启动前也可获取
+func (t *AsyncTickTask) TickDuration() *util.Histogram {
+	return t.duration.Get(func() *util.Histogram {
+		return util.NewHistogram()
+	})
+}
+
 func (t *AsyncTickTask) Go() error {
-	t.handler.(ITickTask).Tick(nil)
+	t.SetDescription(TickDurationKey, t.TickDuration())
+	defer t.ticks.Wait()
+	t.fire(nil)
 	for {
 		select {
 		case c := <-t.Ticker.C:
-			t.handler.(ITickTask).Tick(c)
+			t.fire(c)
 		case <-t.Done():
 			return nil
 		}
 	}
-}
\ No newline at end of file
+}
+
+// fire 按重叠策略运行、排队或跳过一次 Tick
+func (t *AsyncTickTask) fire(value any) {
+	t.overlapMux.Lock()
+	defer t.overlapMux.Unlock()
+	if t.running > 0 && (t.Overlap != TICK_OVERLAP_CONCURRENT || t.MaxConcurrency > 0 && t.running >= t.MaxConcurrency) {
+		if t.Overlap == TICK_OVERLAP_QUEUE_ONE && !t.pending {
+			t.pending, t.pendingValue = true, value
+			t.SetDescription(TickDelayedKey, t.delayed.Add(1))
+			return
+		}
+		t.SetDescription(TickSkippedKey, t.skipped.Add(1))
+		return
+	}
+	t.running++
+	t.ticks.Add(1)
+	t.goWithLabels(func() { t.runTick(value) })
+}
+
+func (t *AsyncTickTask) runTick(value any) {
+	defer t.ticks.Done()
+	for {
+		t.tick(value)
+		t.overlapMux.Lock()
+		if !t.pending || t.IsStopped() {
+			t.running--
+			t.pending, t.pendingValue = false, nil
+			t.overlapMux.Unlock()
+			return
+		}
+		value, t.pending, t.pendingValue = t.pendingValue, false, nil
+		t.overlapMux.Unlock()
+	}
+}
+
+func (t *AsyncTickTask) tick(value any) {
+	start := time.Now()
+	defer func() {
+		t.TickDuration().Observe(time.Since(start))
+		if !ThrowPanic {
+			if r := recover(); r != nil {
+				err := errors.New(fmt.Sprint(r))
+				t.Error("tick panic", "error", err, "stack", string(debug.Stack()))
+				metrics().TaskPanicked(t.handler)
+				t.publishCause(EVENT_PANIC, err)
+				t.Stop(errors.Join(err, ErrPanic))
+			}
+		}
+	}()
+	t.handler.(ITickTask).Tick(value)
+}
@@ -0,0 +1,117 @@
+package task
+
+import (
+	"time"
+)
+
+const (
+	CIRCUIT_STATE_CLOSED CircuitState = iota
+	CIRCUIT_STATE_OPEN
+	CIRCUIT_STATE_HALF_OPEN
+)
+
+const CircuitStateKey = "circuitState"
+
+type (
+	CircuitState byte
+	// CircuitBreaker pauses restarts of a task that keeps failing.
+	// After FailureThreshold failures within Window the circuit opens and restarts wait for CoolDown,
+	// the next restart is a half-open probe: a successful start closes the circuit, a failure opens it again.
+	// Each task needs its own CircuitBreaker.
+	CircuitBreaker struct {
+		FailureThreshold int
+		Window           time.Duration // 0 means failures never expire
+		CoolDown         time.Duration
+		state            CircuitState
+		failures         []time.Time
+		openUntil        time.Time
+	}
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CIRCUIT_STATE_OPEN:
+		return "open"
+	case CIRCUIT_STATE_HALF_OPEN:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// GetState returns the current circuit state
+func (cb *CircuitBreaker) GetState() CircuitState {
+	return cb.state
+}
+
+// onFailure records a failure and returns the delay (counted from startTime) extended to the end of the cool-down
+func (cb *CircuitBreaker) onFailure(now, startTime time.Time, delay time.Duration) (time.Duration, bool) {
+	changed := false
+	switch cb.state {
+	case CIRCUIT_STATE_HALF_OPEN:
+		cb.open(now)
+		changed = true
+	case CIRCUIT_STATE_CLOSED:
+		cb.failures = append(cb.failures, now)
+		if cb.Window > 0 {
+			i := 0
+			for i < len(cb.failures) && now.Sub(cb.failures[i]) > cb.Window {
+				i++
+			}
+			cb.failures = cb.failures[i:]
+		}
+		if cb.FailureThreshold > 0 && len(cb.failures) >= cb.FailureThreshold {
+			cb.open(now)
+			changed = true
+		}
+	}
+	if cb.state == CIRCUIT_STATE_OPEN {
+		if remain := cb.openUntil.Sub(startTime); remain > delay {
+			delay = remain
+		}
+	}
+	return delay, changed
+}
+
+func (cb *CircuitBreaker) open(now time.Time) {
+	cb.state = CIRCUIT_STATE_OPEN
+	cb.failures = cb.failures[:0]
+	cb.openUntil = now.Add(cb.CoolDown)
+}
+
+// onRestart turns an open circuit into half-open when the cool-down has passed
+func (cb *CircuitBreaker) onRestart(now time.Time) bool {
+	if cb.state == CIRCUIT_STATE_OPEN && !now.Before(cb.openUntil) {
+		cb.state = CIRCUIT_STATE_HALF_OPEN
+		return true
+	}
+	return false
+}
+
+// onSuccess closes a half-open circuit
+func (cb *CircuitBreaker) onSuccess() bool {
+	if cb.state == CIRCUIT_STATE_HALF_OPEN {
+		cb.state = CIRCUIT_STATE_CLOSED
+		return true
+	}
+	return false
+}
+
+func (task *Task) publishCircuitState() {
+	cb := task.retry.CircuitBreaker
+	task.SetDescription(CircuitStateKey, cb.state.String())
+	if cb.state == CIRCUIT_STATE_OPEN {
+		task.SetDescription("circuitOpenUntil", cb.openUntil.Format(time.DateTime))
+	} else {
+		task.RemoveDescription("circuitOpenUntil")
+	}
+	task.Warn("circuit state change", "taskId", task.ID, "state", cb.state)
+	if task.parent != nil {
+		task.parent.onCircuitStateChange(task.handler, cb.state)
+	}
+}
+
+// SetCircuitBreaker enables circuit breaking for restarts of this task
+func (task *Task) SetCircuitBreaker(cb *CircuitBreaker) {
+	task.retry.CircuitBreaker = cb
+}
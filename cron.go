@@ -0,0 +1,331 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	CRON_MISSED_SKIP     CronMissedPolicy = iota // 丢弃错过的执行，仅在宽限期内补执行最近一次
+	CRON_MISSED_RUN_ONCE                         // 错过的多次执行合并为一次
+	CRON_MISSED_CATCH_UP                         // 按计划时间逐个补执行
+)
+
+const (
+	CronKey       = "cron"
+	NextRunKey    = "nextRun"
+	MissedRunsKey = "missedRuns"
+)
+
+// MaxCronCatchUp 单次补执行的最大次数
+var MaxCronCatchUp = 100
+
+var ErrCronSpec = errors.New("invalid cron spec")
+
+type (
+	// CronMissedPolicy 错过计划时间（Tick 耗时过长、任务重启等）时的处理策略
+	CronMissedPolicy byte
+	// ICronTask 按 cron 表达式调度的定时任务接口
+	ICronTask interface {
+		IChannelTask
+		GetCronSpec() string
+	}
+	// CronSchedule 解析后的 cron 表达式
+	CronSchedule struct {
+		second, minute, hour, dom, month, dow uint64
+		domStar, dowStar                      bool
+		every                                 time.Duration
+		Location                              *time.Location
+	}
+	// CronTask cron 定时任务，Tick 收到的是计划执行时间（time.Time）
+	CronTask struct {
+		ChannelTask
+		Spec     string           // cron 表达式，也可以重写 GetCronSpec
+		Location *time.Location   // 时区，默认使用表达式中的 CRON_TZ 或本地时区
+		Jitter   time.Duration    // 每次执行随机延后 [0, Jitter)
+		Grace    time.Duration    // CRON_MISSED_SKIP 下允许迟到的时长，默认 1 秒
+		Missed   CronMissedPolicy // 错过执行的处理策略
+		Schedule *CronSchedule
+		lastRun  atomic.Int64
+		missed   atomic.Uint64
+	}
+	cronField struct {
+		min, max uint
+		names    map[string]uint
+	}
+)
+
+var (
+	cronSeconds = cronField{0, 59, nil}
+	cronMinutes = cronField{0, 59, nil}
+	cronHours   = cronField{0, 23, nil}
+	cronDom     = cronField{1, 31, nil}
+	cronMonths  = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+func (p CronMissedPolicy) String() string {
+	switch p {
+	case CRON_MISSED_RUN_ONCE:
+		return "run-once"
+	case CRON_MISSED_CATCH_UP:
+		return "catch-up"
+	default:
+		return "skip"
+	}
+}
+
+// ParseCron 解析 cron 表达式
+// 支持 5 段（分 时 日 月 周）或 6 段（秒 分 时 日 月 周）、@daily 等描述符、@every <duration>，以及 CRON_TZ=<时区> 前缀
+func ParseCron(spec string) (s *CronSchedule, err error) {
+	s = &CronSchedule{Location: time.Local}
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		zone, rest, _ := strings.Cut(spec, " ")
+		_, zone, _ = strings.Cut(zone, "=")
+		if s.Location, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCronSpec, err)
+		}
+		spec = strings.TrimSpace(rest)
+	}
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		if s.every, err = time.ParseDuration(strings.TrimSpace(every)); err != nil || s.every <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrCronSpec, spec)
+		}
+		return
+	}
+	if descriptor, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: %q expects 5 or 6 fields", ErrCronSpec, spec)
+	}
+	for i, target := range []*uint64{&s.second, &s.minute, &s.hour, &s.dom, &s.month, &s.dow} {
+		if *target, err = []cronField{cronSeconds, cronMinutes, cronHours, cronDom, cronMonths, cronDow}[i].parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrCronSpec, spec, err)
+		}
+	}
+	s.domStar, s.dowStar = fields[3] == "*" || fields[3] == "?", fields[5] == "*" || fields[5] == "?"
+	if s.dow&(1<<7) != 0 { // 7 也表示周日
+		s.dow |= 1
+	}
+	return
+}
+
+func (f cronField) parse(expr string) (set uint64, err error) {
+	for _, part := range strings.Split(expr, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := uint(1)
+		if hasStep {
+			if step64, err := strconv.ParseUint(stepPart, 10, 8); err != nil || step64 == 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			} else {
+				step = uint(step64)
+			}
+		}
+		start, end := f.min, f.max
+		if rangePart != "*" && rangePart != "?" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			if start, err = f.value(low); err != nil {
+				return
+			}
+			if isRange {
+				if end, err = f.value(high); err != nil {
+					return
+				}
+			} else if !hasStep {
+				end = start
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return
+}
+
+func (f cronField) value(s string) (uint, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(v) < f.min || uint(v) > f.max {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return uint(v), nil
+}
+
+func (s *CronSchedule) dayMatch(t time.Time) bool {
+	dom, dow := s.dom&(1<<uint(t.Day())) != 0, s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next 返回 t 之后的下一个计划时间，五年内都没有匹配时返回零值
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.In(s.Location).Truncate(time.Second).Add(time.Second)
+	for limit := t.Year() + 5; t.Year() <= limit; {
+		y, m, d := t.Date()
+		switch {
+		case s.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, s.Location)
+		case !s.dayMatch(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, s.Location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, s.Location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		case s.second&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (t *CronTask) GetCronSpec() string {
+	return t.Spec
+}
+
+// SetLastRun 设置上次执行的计划时间，启动时据此按 Missed 策略处理错过的执行（例如从持久化中恢复）
+func (t *CronTask) SetLastRun(at time.Time) {
+	t.lastRun.Store(at.UnixNano())
+}
+
+// LastRun 获取上次执行的计划时间
+func (t *CronTask) LastRun() time.Time {
+	if n := t.lastRun.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// MissedRuns 获取被跳过或合并的执行次数
+func (t *CronTask) MissedRuns() uint64 {
+	return t.missed.Load()
+}
+
+func (t *CronTask) Start() (err error) {
+	spec := t.handler.(ICronTask).GetCronSpec()
+	if t.Schedule, err = ParseCron(spec); err != nil {
+		return
+	}
+	if t.Location != nil {
+		t.Schedule.Location = t.Location
+	}
+	next := t.Schedule.Next(time.Now())
+	if last := t.LastRun(); !last.IsZero() {
+		next = t.Schedule.Next(last)
+	}
+	if next.IsZero() {
+		return fmt.Errorf("%w: %q never runs", ErrCronSpec, spec)
+	}
+	signal := make(chan time.Time)
+	t.SignalChan = signal
+	t.SetDescription(CronKey, spec)
+	t.goWithLabels(func() { t.produce(signal, next) })
+	return
+}
+
+// produce 等到计划时间后按 Missed 策略把计划时间投递给事件循环
+func (t *CronTask) produce(signal chan<- time.Time, next time.Time) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		t.SetDescription(NextRunKey, next.Format(time.DateTime))
+		var jitter time.Duration
+		if t.Jitter > 0 {
+			jitter = randDuration(0, t.Jitter)
+		}
+		timer.Reset(time.Until(next) + jitter)
+		select {
+		case <-timer.C:
+		case <-t.Done():
+			return
+		}
+		var runs []time.Time
+		runs, next = t.due(next, time.Now())
+		for _, at := range runs {
+			var expire <-chan time.Time
+			if t.Missed == CRON_MISSED_SKIP {
+				expire = time.After(time.Until(at.Add(t.Jitter + t.grace())))
+			}
+			select {
+			case signal <- at:
+				t.lastRun.Store(at.UnixNano())
+			case <-expire:
+				t.skip(1)
+			case <-t.Done():
+				return
+			}
+		}
+	}
+}
+
+// due 计算 now 之前到期的计划时间，返回需要执行的时间和下一个计划时间
+func (t *CronTask) due(next, now time.Time) (runs []time.Time, after time.Time) {
+	for after = next; !after.IsZero() && !after.After(now); after = t.Schedule.Next(after) {
+		if runs = append(runs, after); t.Missed == CRON_MISSED_CATCH_UP && len(runs) >= MaxCronCatchUp {
+			t.skip(1)
+			runs = runs[1:]
+		}
+	}
+	switch t.Missed {
+	case CRON_MISSED_SKIP:
+		for len(runs) > 0 && now.Sub(runs[0]) > t.Jitter+t.grace() {
+			t.skip(1)
+			runs = runs[1:]
+		}
+		fallthrough
+	case CRON_MISSED_RUN_ONCE:
+		if len(runs) > 1 {
+			t.skip(len(runs) - 1)
+			runs = runs[len(runs)-1:]
+		}
+	}
+	return
+}
+
+func (t *CronTask) grace() time.Duration {
+	if t.Grace > 0 {
+		return t.Grace
+	}
+	return time.Second
+}
+
+func (t *CronTask) skip(n int) {
+	t.SetDescription(MissedRunsKey, t.missed.Add(uint64(n)))
+}
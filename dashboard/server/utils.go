@@ -151,6 +151,8 @@ func TaskStateToString(state task.TaskState) string {
 		return "DISPOSING"
 	case task.TASK_STATE_DISPOSED:
 		return "DISPOSED"
+	case task.TASK_STATE_PAUSED:
+		return "PAUSED"
 	default:
 		return "UNKNOWN"
 	}
@@ -36,6 +36,7 @@ const TaskDetail: React.FC<TaskDetailProps> = ({
       4: "success", // GOING
       5: "warning", // DISPOSING
       6: "error", // DISPOSED
+      7: "warning", // PAUSED
     };
     return colors[state] || "default";
   };
@@ -59,6 +60,7 @@ const TaskDetail: React.FC<TaskDetailProps> = ({
       4: t("taskState.going"),
       5: t("taskState.disposing"),
       6: t("taskState.disposed"),
+      7: t("taskState.paused"),
     };
     return stateMap[state] || `状态${state}`;
   };
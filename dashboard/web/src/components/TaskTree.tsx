@@ -77,6 +77,7 @@ const TaskTreeComponent: React.FC = () => {
       4: "success", // GOING
       5: "warning", // DISPOSING
       6: "error", // DISPOSED
+      7: "warning", // PAUSED
     };
     return colors[state] || "default";
   };
@@ -90,6 +91,7 @@ const TaskTreeComponent: React.FC = () => {
       4: t("taskState.going"), // GOING
       5: t("taskState.disposing"), // DISPOSING
       6: t("taskState.disposed"), // DISPOSED
+      7: t("taskState.paused"), // PAUSED
     };
     return stateMap[state] || `状态${state}`;
   };
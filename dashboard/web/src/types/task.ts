@@ -4,7 +4,7 @@ export interface TaskInfo {
   owner: string;
   startTime: string;
   description: Record<string, string>;
-  state: number; // 0=INIT, 1=STARTING, 2=STARTED, 3=RUNNING, 4=GOING, 5=DISPOSING, 6=DISPOSED
+  state: number; // 0=INIT, 1=STARTING, 2=STARTED, 3=RUNNING, 4=GOING, 5=DISPOSING, 6=DISPOSED, 7=PAUSED
   blocked?: TaskInfo;
   blocking?: boolean;
   pointer: string;
@@ -26,7 +26,7 @@ export interface TaskHistory {
   startTime: string;
   endTime: string;
   duration: number;
-  state: number; // 0=INIT, 1=STARTING, 2=STARTED, 3=RUNNING, 4=GOING, 5=DISPOSING, 6=DISPOSED
+  state: number; // 0=INIT, 1=STARTING, 2=STARTED, 3=RUNNING, 4=GOING, 5=DISPOSING, 6=DISPOSED, 7=PAUSED
   stopReason?: string;
   retryCount: number;
   descriptions: Record<string, string>;
@@ -0,0 +1,191 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	DEPEND_ON_STARTED DependCondition = iota
+	DEPEND_ON_COMPLETED
+)
+
+const (
+	DEPEND_FAIL_STOP DependFailPolicy = iota
+	DEPEND_FAIL_IGNORE
+	DEPEND_FAIL_STOP_JOB
+)
+
+const (
+	DependsOnKey  = "dependsOn"
+	DependFailKey = "dependFail"
+	WaitForKey    = "waitFor"
+)
+
+var ErrDependency = errors.New("dependency failed")
+
+type (
+	// DependCondition is the state a prerequisite has to reach before the dependent starts
+	DependCondition byte
+	// DependFailPolicy decides what happens to a waiting child when a prerequisite can no longer reach its condition
+	DependFailPolicy byte
+	// Dependency can be passed to AddTask as an option, the child is started only after Task reaches Condition.
+	// Task must be a sibling that was added to the same Job before the child, so the graph is always acyclic.
+	Dependency struct {
+		Task      ITask
+		Condition DependCondition
+	}
+	dependState byte
+)
+
+const (
+	dependPending dependState = iota
+	dependSatisfied
+	dependFailed
+)
+
+func (c DependCondition) String() string {
+	if c == DEPEND_ON_COMPLETED {
+		return "completed"
+	}
+	return "started"
+}
+
+func (p DependFailPolicy) String() string {
+	switch p {
+	case DEPEND_FAIL_IGNORE:
+		return "ignore"
+	case DEPEND_FAIL_STOP_JOB:
+		return "stop-job"
+	default:
+		return "stop"
+	}
+}
+
+func (d Dependency) String() string {
+	return fmt.Sprintf("%d:%s", d.Task.GetTaskID(), d.Condition)
+}
+
+// After starts the child once t has started
+func After(t ITask) Dependency {
+	return Dependency{Task: t, Condition: DEPEND_ON_STARTED}
+}
+
+// AfterSuccess starts the child once t has completed successfully (stopped with ErrTaskComplete)
+func AfterSuccess(t ITask) Dependency {
+	return Dependency{Task: t, Condition: DEPEND_ON_COMPLETED}
+}
+
+// checkDepends makes sure every prerequisite is an earlier sibling
+func (mt *Job) checkDepends(task *Task) error {
+	for _, dep := range task.depends {
+		if dep.Task.GetTask() == task {
+			return fmt.Errorf("%w: task %d depends on itself", ErrDependency, task.ID)
+		}
+		if dep.Task.GetTask().parent != mt {
+			return fmt.Errorf("%w: task %d is not a sibling of task %d", ErrDependency, dep.Task.GetTaskID(), task.ID)
+		}
+	}
+	return nil
+}
+
+// park holds back a child with unmet dependencies, the child keeps the event loop alive and is removed once stopped
+func (e *EventLoop) park(mt *Job, child ITask) bool {
+	task := child.GetTask()
+	if len(task.depends) == 0 || e.children[child] != nil {
+		return false
+	}
+	lc := &loopChild{parked: true, waitFor: slices.Clone(task.depends)}
+	e.children[child] = lc
+	if !e.resolve(mt, child, lc) {
+		lc.parked = false
+		return false
+	}
+	e.parked++
+	gen := lc.gen
+	context.AfterFunc(task.Context, func() {
+		e.post(loopEvent{child: child, gen: gen})
+	})
+	return true
+}
+
+// resolve re-evaluates the dependencies of a parked child and reports whether it still has to wait
+func (e *EventLoop) resolve(mt *Job, child ITask, lc *loopChild) bool {
+	task := child.GetTask()
+	remain := lc.waitFor[:0]
+	for _, dep := range lc.waitFor {
+		switch state, reason := e.dependState(dep); state {
+		case dependPending:
+			remain = append(remain, dep)
+		case dependFailed:
+			err := fmt.Errorf("%w: task %d not %s: %w", ErrDependency, dep.Task.GetTaskID(), dep.Condition, reason)
+			switch task.dependFail {
+			case DEPEND_FAIL_IGNORE:
+				task.Warn("dependency failed, start anyway", "taskId", task.ID, "dependency", dep, "reason", reason)
+				continue
+			case DEPEND_FAIL_STOP_JOB:
+				mt.Stop(err)
+			}
+			lc.waitFor = remain
+			child.Stop(err)
+			return true
+		}
+	}
+	if lc.waitFor = remain; len(remain) > 0 {
+		ids := make([]string, len(remain))
+		for i, dep := range remain {
+			ids[i] = dep.String()
+		}
+		task.SetDescription(WaitForKey, ids)
+		return true
+	}
+	task.RemoveDescription(WaitForKey)
+	return false
+}
+
+// dependState reports whether dep is met, the returned error is why it can no longer be met
+func (e *EventLoop) dependState(dep Dependency) (dependState, error) {
+	prerequisite := dep.Task
+	if lc, ok := e.children[prerequisite]; ok {
+		if dep.Condition == DEPEND_ON_STARTED && lc.started {
+			return dependSatisfied, nil
+		}
+		return dependPending, nil
+	}
+	startup := prerequisite.GetTask().startup
+	if !prerequisite.IsStopped() {
+		if startup.IsRejected() { // rejected by addChild, e.g. ExistTaskError, it will never reach the event loop
+			_, err := startup.Wait()
+			return dependFailed, err
+		}
+		return dependPending, nil // not reached the event loop yet
+	}
+	if errors.Is(prerequisite.StopReason(), ErrTaskComplete) || dep.Condition == DEPEND_ON_STARTED && startup.IsResolved() {
+		return dependSatisfied, nil
+	}
+	return dependFailed, prerequisite.StopReason()
+}
+
+// wakeDependents starts parked children whose dependencies are now met, called after a child starts or leaves the event loop
+func (e *EventLoop) wakeDependents(mt *Job) {
+	if e.parked == 0 || mt.IsStopped() {
+		return
+	}
+	var ready []ITask
+	for child, lc := range e.children {
+		if lc.parked && len(lc.waitFor) > 0 && !e.resolve(mt, child, lc) {
+			lc.parked = false
+			e.parked--
+			ready = append(ready, child)
+		}
+	}
+	for _, child := range ready {
+		if child.IsStopped() {
+			e.removeDisposed(mt, child, false)
+		} else {
+			e.startChild(mt, child)
+		}
+	}
+}
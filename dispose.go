@@ -0,0 +1,269 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const LeakedChildrenKey = "leakedChildren"
+
+type (
+	// DisposeConfig 子任务销毁超时配置
+	DisposeConfig struct {
+		Timeout    time.Duration // 等待单个子任务销毁的时长，0 表示不限制
+		Proceed    bool          // 超时后不再等待，记录泄漏并继续销毁父任务
+		Sequential bool          // 逐个销毁子任务，默认并发销毁
+	}
+	// disposeOrder 事件循环在 Job 停止后按依赖关系销毁子任务
+	// 通过 Using 依赖兄弟任务的子任务先完成销毁，被依赖的任务随后才销毁，互不依赖的子任务并发销毁
+	disposeOrder struct {
+		uses       map[ITask][]ITask   // 子任务依赖的兄弟任务
+		dependents map[ITask]int       // 尚未销毁完成的依赖该任务的兄弟任务数量
+		pending    map[ITask]loopEvent // 已停止但仍在等待依赖方销毁的子任务
+		inflight   int
+	}
+	// disposeLeaks 销毁超时被放弃等待的子任务
+	disposeLeaks struct {
+		sync.Mutex
+		children []ITask
+	}
+)
+
+// SetDisposeTimeout 设置等待子任务销毁的超时，超时的子任务会连同其 disposeProcess 和堆栈一起记录日志
+// proceed 为 true 时父任务不再等待该子任务，并记录为泄漏
+func (mt *Job) SetDisposeTimeout(timeout time.Duration, proceed bool) {
+	mt.disposeConfig.Timeout, mt.disposeConfig.Proceed = timeout, proceed
+}
+
+// SetSequentialDispose 设置逐个销毁子任务，默认并发销毁，两种方式都遵循 Using 声明的依赖顺序
+func (mt *Job) SetSequentialDispose(sequential bool) {
+	mt.disposeConfig.Sequential = sequential
+}
+
+// LeakedChildren 获取因销毁超时被放弃等待的子任务
+func (mt *Job) LeakedChildren() []ITask {
+	mt.leaks.Lock()
+	defer mt.leaks.Unlock()
+	return append([]ITask(nil), mt.leaks.children...)
+}
+
+// waitChildDispose 等待子任务销毁，超过 DisposeConfig.Timeout 时报告卡住的子任务
+func (mt *Job) waitChildDispose(child ITask) {
+	// 等待事件循环移除子任务而非 shutdown：子任务的 dispose 完成后事件循环仍要访问 Job 才能移除它，
+	// 尚未被事件循环启动的子任务也只会在事件循环中销毁
+	removed := child.GetTask().removed
+	if mt.disposeConfig.Timeout <= 0 {
+		removed.Wait()
+		return
+	}
+	done := removed.Done()
+	start := time.Now()
+	timer := time.NewTimer(mt.disposeConfig.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+			mt.reportStuckDispose(child, time.Since(start))
+			if mt.disposeConfig.Proceed {
+				mt.leaks.Lock()
+				mt.leaks.children = append(mt.leaks.children, child)
+				ids := make([]uint32, len(mt.leaks.children))
+				for i, leaked := range mt.leaks.children {
+					ids[i] = leaked.GetTaskID()
+				}
+				mt.leaks.Unlock()
+				mt.SetDescription(LeakedChildrenKey, ids)
+				return
+			}
+			timer.Reset(mt.disposeConfig.Timeout)
+		}
+	}
+}
+
+func (mt *Job) reportStuckDispose(child ITask, elapsed time.Duration) {
+	process, _ := child.GetTask().GetDescription("disposeProcess")
+	stack := "unknown"
+	if id := child.GetTask().disposeGoroutine.Load(); id != 0 {
+		stack = goroutineStack(id)
+	}
+	mt.Error("child dispose timeout", "childId", child.GetTaskID(), "ownerType", child.GetOwnerType(), "state", child.GetState(), "disposeProcess", process, "elapsed", elapsed, "proceed", mt.disposeConfig.Proceed, "stack", stack)
+}
+
+// goroutineID 获取当前 goroutine 的 ID
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	field := bytes.Fields(bytes.TrimPrefix(buf[:n], []byte("goroutine ")))
+	if len(field) == 0 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(field[0]), 10, 64)
+	return id
+}
+
+// goroutineStack 获取指定 goroutine 的堆栈
+func goroutineStack(id uint64) string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	prefix := []byte(fmt.Sprintf("goroutine %d ", id))
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(block, prefix) {
+			return string(block)
+		}
+	}
+	return "exited"
+}
+
+// waitChildrenDispose 停止所有子任务并等待它们销毁，销毁顺序由事件循环中的 disposeOrder 决定
+func (mt *Job) waitChildrenDispose(stopReason error) {
+	mt.eventLoop.active(mt)
+	var children []ITask
+	mt.children.Range(func(key, value any) bool {
+		child := value.(ITask)
+		child.Stop(stopReason)
+		children = append(children, child)
+		return true
+	})
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	waiting := make(map[uint32]struct{}, len(children))
+	setWaiting := func() {
+		if len(waiting) == 0 {
+			mt.RemoveDescription("waitChildDispose")
+		} else {
+			mt.SetDescription("waitChildDispose", slices.Sorted(maps.Keys(waiting)))
+		}
+	}
+	for _, child := range children {
+		waiting[child.GetTaskID()] = struct{}{}
+	}
+	setWaiting()
+	for _, child := range children {
+		wg.Add(1)
+		mt.goWithLabels(func() {
+			defer wg.Done()
+			mt.waitChildDispose(child)
+			mux.Lock()
+			delete(waiting, child.GetTaskID())
+			setWaiting()
+			mux.Unlock()
+		})
+	}
+	wg.Wait()
+}
+
+func newDisposeOrder(children map[ITask]*loopChild) *disposeOrder {
+	d := &disposeOrder{
+		uses:       make(map[ITask][]ITask),
+		dependents: make(map[ITask]int),
+		pending:    make(map[ITask]loopEvent),
+	}
+	for child := range children {
+		for _, resource := range child.GetTask().resources {
+			if t, ok := resource.(ITask); ok && t != child {
+				if _, ok := children[t]; ok {
+					d.uses[child] = append(d.uses[child], t)
+					d.dependents[t]++
+				}
+			}
+		}
+	}
+	return d
+}
+
+// disposeChild 在 Job 停止后接管子任务的销毁，返回 false 表示 Job 仍在运行
+func (e *EventLoop) disposeChild(mt *Job, event loopEvent) bool {
+	if !mt.IsStopped() {
+		return false
+	}
+	if e.disposal == nil {
+		e.disposal = newDisposeOrder(e.children)
+	}
+	if e.disposal.dependents[event.child] > 0 {
+		e.disposal.pending[event.child] = event
+		e.breakCycle(mt)
+	} else {
+		e.launchDispose(mt, event)
+	}
+	return true
+}
+
+// launchDispose 销毁子任务，OnDescendantsDispose 监听仍在事件循环中调用，
+// 子任务的 dispose 默认在独立的 goroutine 中执行，完成后投递事件由事件循环移除
+func (e *EventLoop) launchDispose(mt *Job, event loopEvent) {
+	e.disposal.inflight++
+	event.disposed, event.ack = true, nil
+	if mt.disposeConfig.Sequential {
+		mt.onChildDispose(event.child)
+		e.dispatch(mt, event)
+		return
+	}
+	mt.onDescendantsDispose(event.child)
+	event.child.GetTask().goWithLabels(func() {
+		defer func() {
+			if err := recover(); err != nil {
+				mt.Error("child dispose panic", "childId", event.child.GetTaskID(), "err", err, "stack", string(debug.Stack()))
+				if ThrowPanic {
+					panic(err)
+				}
+			}
+			e.post(event)
+		}()
+		event.child.dispose()
+	})
+}
+
+// released 子任务已移出事件循环，释放其依赖的兄弟任务
+// 所有子任务都移除后丢弃销毁顺序，Job 下次停止时按当时的子任务重新计算
+func (e *EventLoop) released(mt *Job, child ITask, disposed bool) {
+	d := e.disposal // 顺序销毁时 launchDispose 会嵌套移除其它子任务
+	if disposed {
+		d.inflight--
+	}
+	uses := d.uses[child]
+	delete(d.uses, child)
+	delete(d.pending, child)
+	for _, t := range uses {
+		if d.dependents[t]--; d.dependents[t] == 0 {
+			if event, ok := d.pending[t]; ok {
+				delete(d.pending, t)
+				e.launchDispose(mt, event)
+			}
+		}
+	}
+	if len(e.children) == 0 {
+		e.disposal, e.settled = nil, true
+	} else if e.disposal == d {
+		e.breakCycle(mt)
+	}
+}
+
+// breakCycle 剩余的子任务都在互相等待时忽略依赖关系直接销毁
+func (e *EventLoop) breakCycle(mt *Job) {
+	if e.disposal.inflight > 0 || len(e.disposal.pending) == 0 || len(e.disposal.pending) < len(e.children) {
+		return
+	}
+	mt.Warn("dispose children with circular dependency", "count", len(e.disposal.pending), "jobId", mt.GetTaskID())
+	pending := e.disposal.pending
+	e.disposal.pending = make(map[ITask]loopEvent)
+	for child, event := range pending {
+		e.disposal.dependents[child] = 0
+		e.launchDispose(mt, event)
+	}
+}
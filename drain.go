@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const DrainingKey = "draining"
+
+var (
+	ErrDraining = errors.New("job draining")
+	ErrDrained  = fmt.Errorf("drained %w", ErrTaskComplete)
+)
+
+// Drain 排空 Job：拒绝新的子任务（ErrDraining），等待已有子任务自然结束后以 ErrDrained 停止 Job 自身
+// ctx 先结束时强制停止 Job 及剩余子任务并返回 ctx 的错误原因，Drain 在 Job 销毁完成后返回
+// 排空期间子任务全部结束时普通 Job 不会自动停止，由 Drain 以 ErrDrained 停止
+// 不能在该 Job 的事件循环中调用
+func (mt *Job) Drain(ctx context.Context) (err error) {
+	if !mt.draining.CompareAndSwap(false, true) {
+		return ErrDraining
+	}
+	notify, drainStart := mt.getDrainNotify(), time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		mt.SetDescription(DrainingKey, fmt.Sprintf("since %s, deadline %s", drainStart.Format(time.DateTime), deadline.Format(time.DateTime)))
+	} else {
+		mt.SetDescription(DrainingKey, fmt.Sprintf("since %s", drainStart.Format(time.DateTime)))
+	}
+	mt.Info("job draining", "jobId", mt.ID, "children", mt.Size.Load())
+	for mt.hasChildren() {
+		select {
+		case <-notify:
+		case <-mt.Done():
+			_ = mt.WaitStopped()
+			return mt.StopReason()
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+			mt.Warn("job drain timeout, force stop children", "jobId", mt.ID, "children", mt.Size.Load(), "elapsed", time.Since(drainStart))
+			mt.Stop(errors.Join(ErrDraining, err))
+			_ = mt.WaitStopped()
+			return
+		}
+	}
+	mt.Info("job drained", "jobId", mt.ID, "elapsed", time.Since(drainStart))
+	mt.Stop(ErrDrained)
+	_ = mt.WaitStopped()
+	return
+}
+
+// IsDraining 检查 Job 是否正在排空
+func (mt *Job) IsDraining() bool {
+	return mt.draining.Load()
+}
+
+// hasChildren 替换前后不在 children 中的任务同样计入 Size
+func (mt *Job) hasChildren() (ok bool) {
+	if mt.Size.Load() > 0 {
+		return true
+	}
+	mt.children.Range(func(key, value any) bool {
+		ok = true
+		return false
+	})
+	return
+}
+
+// notifyDrain 排空期间子任务移除时唤醒 Drain
+func (mt *Job) notifyDrain() {
+	if mt.draining.Load() {
+		select {
+		case mt.getDrainNotify() <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (mt *Job) getDrainNotify() chan struct{} {
+	return mt.drainNotify.Get(func() chan struct{} {
+		return make(chan struct{}, 1)
+	})
+}
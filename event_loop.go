@@ -1,12 +1,16 @@
 package task
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"runtime/debug"
-	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/langhuihui/gotask/util"
 )
 
 // Singleton 单例模式
@@ -32,17 +36,80 @@ func (s *Singleton[T]) Get(newF func() T) T {
 	return ch.(T)
 }
 
+type (
+	// loopEvent 子任务信号通知
+	loopEvent struct {
+		child    ITask
+		gen      uint32
+		value    any
+		retry    bool
+		disposed bool // Job 停止后子任务在独立 goroutine 中销毁完成
+		ack      chan bool
+	}
+	// loopChild 事件循环中子任务的状态
+	loopChild struct {
+		gen         uint32
+		retryCancel context.CancelFunc
+		started     bool         // 至少启动成功过一次
+		parked      bool         // 等待依赖满足后才启动
+		waitFor     []Dependency // 尚未满足的依赖
+	}
+)
+
 // EventLoop 事件循环
+// 子任务结束、ChannelTask 信号以及重试定时器都投递到共享的通知队列，事件循环按投递顺序逐个分发，分发代价与子任务数量无关
 type EventLoop struct {
-	cases    []reflect.SelectCase
-	children []ITask
+	children map[ITask]*loopChild
 	addSub   Singleton[chan any]
+	notify   Singleton[chan struct{}]
+	queueMu  sync.Mutex
+	queue    []loopEvent
+	queued   atomic.Int32 // 通知队列长度，供事件循环无锁读取
 	running  atomic.Bool
+	capacity int
+	maxDepth atomic.Int32
+	rejected atomic.Uint64
+	waited   atomic.Uint64
+	disposal *disposeOrder
+	settled  bool // 子任务已随 Job 停止全部移除，Job 可能正在重试，事件循环退出时不再自动停止它
+	parked   int
 }
 
+// EventLoopStats 事件循环队列统计
+type EventLoopStats struct {
+	Capacity int    // 输入通道容量
+	Depth    int    // 输入通道当前排队数
+	MaxDepth int    // 输入通道历史最大排队数
+	Pending  int    // 通知队列中待分发的事件数
+	Rejected uint64 // 通道已满被拒绝的次数
+	Waited   uint64 // 通道已满等待空位的次数
+}
+
+const DefaultInputCapacity = 20
+
 func (e *EventLoop) getInput() chan any {
 	return e.addSub.Get(func() chan any {
-		return make(chan any, 20)
+		return make(chan any, util.Conditional(e.capacity > 0, e.capacity, DefaultInputCapacity))
+	})
+}
+
+func (e *EventLoop) stats() (stats EventLoopStats) {
+	ch := e.getInput()
+	stats.Capacity, stats.Depth = cap(ch), len(ch)
+	stats.MaxDepth = int(e.maxDepth.Load())
+	stats.Rejected, stats.Waited = e.rejected.Load(), e.waited.Load()
+	stats.Pending = e.pending()
+	return
+}
+
+// pending 通知队列中待分发的事件数
+func (e *EventLoop) pending() int {
+	return int(e.queued.Load())
+}
+
+func (e *EventLoop) getNotify() chan struct{} {
+	return e.notify.Get(func() chan struct{} {
+		return make(chan struct{}, 1)
 	})
 }
 
@@ -51,36 +118,250 @@ func (e *EventLoop) active(mt *Job) {
 		mt.parent.eventLoop.active(mt.parent)
 	}
 	if e.running.CompareAndSwap(false, true) {
-		go e.run(mt)
+		mt.goWithLabels(func() { e.run(mt) })
 	}
 }
 
 func (e *EventLoop) add(mt *Job, sub any) (err error) {
+	return e.send(nil, mt, sub)
+}
+
+// send 投递到输入通道，ctx 为 nil 时通道已满立即返回 ErrTooManyChildren，否则等待空位
+func (e *EventLoop) send(ctx context.Context, mt *Job, sub any) (err error) {
 	shouldActive := true
 	switch sub.(type) {
 	case TaskStarter, TaskBlock, TaskGo:
 	case IJob:
 		shouldActive = false
 	}
+	ch := e.getInput()
 	select {
-	case e.getInput() <- sub:
-		if shouldActive || mt.IsStopped() {
-			e.active(mt)
+	case ch <- sub:
+	default:
+		if ctx == nil {
+			e.rejected.Add(1)
+			return ErrTooManyChildren
+		}
+		e.waited.Add(1)
+		e.active(mt) // make sure the loop is draining the channel
+		select {
+		case ch <- sub:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-mt.Done():
+			return mt.StopReason()
+		}
+	}
+	for depth, maxDepth := int32(len(ch)), e.maxDepth.Load(); depth > maxDepth && !e.maxDepth.CompareAndSwap(maxDepth, depth); maxDepth = e.maxDepth.Load() {
+	}
+	if shouldActive || mt.IsStopped() {
+		e.active(mt)
+	}
+	return nil
+}
+
+// post 投递事件并唤醒事件循环，可在任意 goroutine 调用
+func (e *EventLoop) post(event loopEvent) {
+	e.queueMu.Lock()
+	e.queue = append(e.queue, event)
+	e.queued.Store(int32(len(e.queue)))
+	e.queueMu.Unlock()
+	select {
+	case e.getNotify() <- struct{}{}:
+	default:
+	}
+}
+
+func (e *EventLoop) pop() (event loopEvent, ok bool) {
+	e.queueMu.Lock()
+	defer e.queueMu.Unlock()
+	if ok = len(e.queue) > 0; ok {
+		event = e.queue[0]
+		e.queue[0] = loopEvent{}
+		e.queue = e.queue[1:]
+		e.queued.Store(int32(len(e.queue)))
+	}
+	return
+}
+
+// watch 监听子任务的信号，普通任务在 context 结束时投递，ChannelTask 由转发 goroutine 逐个投递信号
+func (e *EventLoop) watch(child ITask) {
+	lc := e.children[child]
+	if lc == nil {
+		lc = &loopChild{}
+		e.children[child] = lc
+	}
+	lc.gen++
+	gen := lc.gen
+	if _, ok := child.(IChannelTask); ok {
+		signal := child.GetSignal()
+		child.GetTask().goWithLabels(func() { e.forward(child, gen, signal) })
+		return
+	}
+	context.AfterFunc(child.GetTask().Context, func() {
+		e.post(loopEvent{child: child, gen: gen})
+	})
+}
+
+// forward 将 ChannelTask 的信号转发到事件循环，等待 Tick 处理完成后再接收下一个信号
+func (e *EventLoop) forward(child ITask, gen uint32, signal any) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(signal)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(child.Done())},
+	}
+	ack := make(chan bool, 1)
+	for {
+		event := loopEvent{child: child, gen: gen, ack: ack}
+		if chosen, rev, _ := reflect.Select(cases); chosen == 0 {
+			event.value = rev.Interface()
+		}
+		if e.post(event); !<-ack {
+			return
+		}
+	}
+}
+
+// scheduleRetry 用退避定时器代替失败子任务的信号，Job 停止时定时器会提前触发
+func (e *EventLoop) scheduleRetry(mt *Job, child ITask) {
+	lc := e.children[child]
+	if lc == nil {
+		lc = &loopChild{}
+		e.children[child] = lc
+	}
+	lc.gen++
+	gen := lc.gen
+	wait := child.GetTask().retryWait()
+	ctx, cancel := context.WithTimeout(mt.Context, wait)
+	lc.retryCancel = cancel
+	child.SetDescription("retryAt", time.Now().Add(wait).Format(time.DateTime))
+	context.AfterFunc(ctx, func() {
+		e.post(loopEvent{child: child, gen: gen, retry: true})
+	})
+}
+
+func (e *EventLoop) remove(mt *Job, child ITask) {
+	e.removeDisposed(mt, child, false)
+}
+
+// removeDisposed 移除子任务，Job 停止后还会释放它依赖的兄弟任务
+func (e *EventLoop) removeDisposed(mt *Job, child ITask, disposed bool) {
+	if child.GetTask().replacedBy != nil {
+		e.handoff(mt, child)
+	}
+	mt.removeChild(child)
+	delete(e.children, child)
+	if e.disposal != nil {
+		e.released(mt, child, disposed)
+	}
+	child.GetTask().terminate(child.StopReason()) // 最后结束，父任务的 waitChildDispose 被唤醒时事件循环已不再访问该子任务
+	e.wakeDependents(mt)
+}
+
+func (e *EventLoop) startChild(mt *Job, child ITask) {
+	if mt.blocked = child; e.park(mt, child) {
+		return
+	}
+	if child.start() {
+		e.watch(child)
+		e.children[child].started = true
+		if child.GetTask().replaces != nil {
+			e.switchReplaced(mt, child)
+		}
+		if mt.IsPaused() { // 暂停中的 Job 添加的子任务启动后同样处于暂停状态
+			child.Pause()
+		}
+		mt.onChildStart(child)
+		e.wakeDependents(mt)
+	} else if child.checkRetry(child.StopReason()) {
+		e.scheduleRetry(mt, child)
+	} else {
+		e.remove(mt, child)
+	}
+}
+
+func (e *EventLoop) dispatch(mt *Job, event loopEvent) {
+	child := event.child
+	lc, ok := e.children[child]
+	if !ok || lc.gen != event.gen {
+		if event.ack != nil {
+			event.ack <- false
+		}
+		return
+	}
+	mt.blocked = child
+	if lc.parked {
+		lc.parked = false
+		e.parked--
+		e.removeDisposed(mt, child, false)
+		return
+	}
+	if event.disposed {
+		e.removeDisposed(mt, child, true)
+		return
+	}
+	if event.retry {
+		lc.retryCancel()
+		lc.retryCancel = nil
+		child.GetTask().RemoveDescription("retryAt")
+		if mt.IsStopped() {
+			e.removeDisposed(mt, child, false)
+			return
+		}
+		child.reset()
+		e.startChild(mt, child)
+		return
+	}
+	switch tt := child.(type) {
+	case IChannelTask:
+		next := true
+		defer func() {
+			event.ack <- next // also sent when Tick panics, so the stop signal can still be forwarded
+		}()
+		if tt.IsStopped() {
+			if next = false; !e.disposeChild(mt, event) {
+				if mt.onChildDispose(child); child.GetTask().restarted() {
+					e.startChild(mt, child)
+				} else {
+					e.remove(mt, child)
+				}
+			}
+		} else if !tt.IsPaused() {
+			tt.Tick(event.value)
 		}
-		return nil
 	default:
-		return ErrTooManyChildren
+		if e.disposeChild(mt, event) {
+			return
+		}
+		if mt.onChildDispose(child); child.GetTask().restarted() {
+			e.startChild(mt, child)
+		} else if child.checkRetry(child.StopReason()) {
+			e.scheduleRetry(mt, child)
+		} else {
+			e.remove(mt, child)
+		}
 	}
 }
 
 func (e *EventLoop) run(mt *Job) {
 	mt.Debug("event loop start", "jobId", mt.GetTaskID(), "type", mt.GetOwnerType())
-	ch := e.getInput()
-	e.cases = []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}}
+	ch, notify := e.getInput(), e.getNotify()
+	if e.children == nil {
+		e.children = make(map[ITask]*loopChild)
+	}
+	var blocked ITask
+	hasChild := false // 只执行过 Call 的事件循环退出时不结束 Job
+	settled := false
+	depth := -1
 	defer func() {
 		err := recover()
 		if err != nil {
+			// 正常退出时 running 已置为 false，新的事件循环可能已经启动，只在 panic 时读取 blocked
+			blocked, mt.blocked = mt.blocked, nil
 			mt.Error("job panic", "err", err, "stack", string(debug.Stack()))
+			metrics().TaskPanicked(mt.handler)
+			mt.publish(EVENT_PANIC, func(event *LifecycleEvent) {
+				event.Cause = fmt.Errorf("%v", err)
+			})
 			if !ThrowPanic {
 				mt.Stop(errors.Join(err.(error), ErrPanic))
 			} else {
@@ -88,21 +369,25 @@ func (e *EventLoop) run(mt *Job) {
 			}
 		}
 		mt.Debug("event loop exit", "jobId", mt.GetTaskID(), "type", mt.GetOwnerType())
-		if !mt.handler.keepalive() {
-			if mt.blocked != nil {
-				mt.Stop(errors.Join(mt.blocked.StopReason(), ErrAutoStop))
+		if (hasChild && !settled && !mt.draining.Load() || err != nil) && !mt.handler.keepalive() {
+			if blocked != nil {
+				mt.Stop(errors.Join(blocked.StopReason(), ErrAutoStop))
 			} else {
 				mt.Stop(ErrAutoStop)
 			}
 		}
-		mt.blocked = nil
 	}()
 
 	// Main event loop - only exit when no more events AND no children
 	for {
 		mt.blocked = nil
+		// 只在变化时上报，避免每次循环都访问指标接收器；子任务随 Job 停止全部移除后 Job 可能已销毁，不再上报
+		if d := len(ch) + e.pending(); d != depth && !e.settled {
+			depth = d
+			metrics().QueueDepth(mt, depth)
+		}
 		if len(ch) == 0 && len(e.children) == 0 {
-			if e.running.CompareAndSwap(true, false) {
+			if settled = e.settled; e.running.CompareAndSwap(true, false) {
 				if len(ch) > 0 { // if add before running set to false
 					mt.Warn("job addSub channel after change running to false", "jobId", mt.GetTaskID())
 					e.active(mt)
@@ -110,51 +395,18 @@ func (e *EventLoop) run(mt *Job) {
 				return
 			}
 		}
-		if chosen, rev, ok := reflect.Select(e.cases); chosen == 0 {
-			switch v := rev.Interface().(type) {
+		select {
+		case rev := <-ch:
+			switch v := rev.(type) {
 			case func():
 				v()
 			case ITask:
-				if len(e.cases) >= 65535 {
-					mt.Warn("task children too many, may cause performance issue", "count", len(e.cases), "taskId", mt.GetTaskID(), "taskType", mt.GetTaskType(), "ownerType", mt.GetOwnerType())
-					v.Stop(ErrTooManyChildren)
-					continue
-				}
-				if mt.blocked = v; v.start() {
-					e.cases = append(e.cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(v.GetSignal())})
-					e.children = append(e.children, v)
-					mt.onChildStart(v)
-				} else {
-					mt.removeChild(v)
-				}
+				hasChild, e.settled = true, false
+				e.startChild(mt, v)
 			}
-		} else {
-			taskIndex := chosen - 1
-			child := e.children[taskIndex]
-			mt.blocked = child
-			switch tt := mt.blocked.(type) {
-			case IChannelTask:
-				if tt.IsStopped() {
-					mt.onChildDispose(child)
-					mt.removeChild(child)
-					e.children = slices.Delete(e.children, taskIndex, taskIndex+1)
-					e.cases = slices.Delete(e.cases, chosen, chosen+1)
-				} else {
-					tt.Tick(rev.Interface())
-				}
-			default:
-				if !ok {
-					if mt.onChildDispose(child); child.checkRetry(child.StopReason()) {
-						if child.reset(); child.start() {
-							e.cases[chosen].Chan = reflect.ValueOf(child.GetSignal())
-							mt.onChildStart(child)
-							continue
-						}
-					}
-					mt.removeChild(child)
-					e.children = slices.Delete(e.children, taskIndex, taskIndex+1)
-					e.cases = slices.Delete(e.cases, chosen, chosen+1)
-				}
+		case <-notify:
+			for event, ok := e.pop(); ok; event, ok = e.pop() {
+				e.dispatch(mt, event)
 			}
 		}
 	}
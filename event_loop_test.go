@@ -1,7 +1,10 @@
 package task
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -45,3 +48,136 @@ func Test_EventLoop(t *testing.T) {
 		return true
 	})
 }
+
+func Test_RetryNotBlockSiblings(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	var failing retryDemoTask
+	failing.SetRetry(-1, time.Hour)
+	job.AddTask(&failing)
+	var sibling Task
+	if err := job.AddTask(&sibling).WaitStarted(); err != nil {
+		t.Fatalf("sibling start failed: %v", err)
+	}
+	called := false
+	job.Call(func() {
+		called = true
+	})
+	if !called {
+		t.Errorf("expected call to run while sibling is backing off")
+	}
+	start := time.Now()
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected pending retry to be canceled, took %v", elapsed)
+	}
+}
+
+var benchmarkChildren = []int{10, 1000, 10000}
+
+// BenchmarkEventLoopCall measures one round trip through a Job's event loop while it holds many idle children
+func BenchmarkEventLoopCall(b *testing.B) {
+	for _, n := range benchmarkChildren {
+		b.Run(fmt.Sprintf("children=%d", n), func(b *testing.B) {
+			var job Job
+			root.AddTask(&job)
+			for i := 0; i < n; i++ {
+				var child Task
+				job.AddTask(&child).WaitStarted()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				job.Call(func() {})
+			}
+			b.StopTimer()
+			job.Stop(ErrTaskComplete)
+			job.WaitStopped()
+		})
+	}
+}
+
+// BenchmarkEventLoopChildStop measures dispatching child completions while many siblings stay idle
+func BenchmarkEventLoopChildStop(b *testing.B) {
+	for _, n := range benchmarkChildren {
+		b.Run(fmt.Sprintf("children=%d", n), func(b *testing.B) {
+			var job Job
+			root.AddTask(&job)
+			for i := 0; i < n; i++ {
+				var child Task
+				job.AddTask(&child).WaitStarted()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var child Task
+				job.AddTask(&child).WaitStarted()
+				child.Stop(ErrTaskComplete)
+				child.WaitStopped()
+			}
+			b.StopTimer()
+			job.Stop(ErrTaskComplete)
+			job.WaitStopped()
+		})
+	}
+}
+
+// BenchmarkReflectSelectDispatch reproduces the previous dispatcher, which paid one reflect.Select
+// over every child signal for each event
+func BenchmarkReflectSelectDispatch(b *testing.B) {
+	for _, n := range benchmarkChildren {
+		b.Run(fmt.Sprintf("children=%d", n), func(b *testing.B) {
+			input := make(chan any, 1)
+			cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(input)}}
+			for i := 0; i < n; i++ {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(make(chan struct{}))})
+			}
+			callback := func() {}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				input <- callback
+				_, rev, _ := reflect.Select(cases)
+				rev.Interface().(func())()
+			}
+		})
+	}
+}
+
+type blockStartTask struct {
+	Task
+	entered, block chan struct{}
+}
+
+func (t *blockStartTask) Start() error {
+	close(t.entered)
+	<-t.block
+	return nil
+}
+
+func Test_AddTaskWait(t *testing.T) {
+	var job Job
+	job.SetInputCapacity(1)
+	root.AddTask(&job)
+	blocker := blockStartTask{entered: make(chan struct{}), block: make(chan struct{})}
+	job.AddTask(&blocker)
+	<-blocker.entered
+	var first, second Task
+	job.AddTask(&first)
+	if err := job.AddTask(&second).WaitStarted(); !errors.Is(err, ErrTooManyChildren) {
+		t.Errorf("expected ErrTooManyChildren, got %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() {
+		close(blocker.block)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var third Task
+	if err := job.AddTaskWait(ctx, &third).WaitStarted(); err != nil {
+		t.Errorf("expected task to wait for space, got %v", err)
+	}
+	stats := job.EventLoopStats()
+	if stats.Capacity != 1 || stats.MaxDepth != 1 || stats.Rejected != 1 || stats.Waited != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
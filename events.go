@@ -0,0 +1,272 @@
+package task
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EVENT_ADDED               LifecycleEventType = iota // 子任务已被 Job 接受
+	EVENT_STARTING                                      // 开始执行 Start
+	EVENT_STARTED                                       // Start 成功
+	EVENT_RUNNING                                       // 开始执行 Run（State 为 RUNNING）或 Go（State 为 GOING）
+	EVENT_STOPPING                                      // 调用 Stop，Cause 为停止原因
+	EVENT_DISPOSING                                     // 开始销毁
+	EVENT_DISPOSED                                      // 销毁完成、启动失败或加入后未能投递到事件循环，Cause 为停止原因
+	EVENT_RETRY_SCHEDULED                               // 停止后安排重试，RetryDelay 为重试延迟
+	EVENT_PANIC                                         // 发生 panic，Cause 为 panic 内容
+	EVENT_DESCRIPTION_CHANGED                           // 描述信息变化，Value 为 nil 表示删除
+)
+
+const (
+	DROP_NEWEST DropPolicy = iota // 缓冲区满时丢弃新事件
+	DROP_OLDEST                   // 缓冲区满时丢弃最早的事件
+)
+
+const DefaultEventBuffer = 256
+
+type (
+	LifecycleEventType byte
+	// DropPolicy 订阅者缓冲区满时的丢弃策略，发布方从不阻塞
+	DropPolicy byte
+	// LifecycleEvent 任务生命周期事件
+	LifecycleEvent struct {
+		Type       LifecycleEventType
+		Time       time.Time
+		Task       ITask
+		TaskID     uint32
+		ParentID   uint32
+		Ancestors  []uint32 // 祖先任务 ID，由近及远，任务加入时记录，只读
+		OwnerType  string
+		Level      byte
+		State      TaskState
+		Cause      error
+		RetryDelay time.Duration
+		Key        string
+		Value      any
+		Caller     string // EVENT_STOPPING 时为调用 Stop 的位置
+	}
+	// Subscription 生命周期事件订阅，通过 Events 接收事件，不再需要时调用 Close
+	Subscription struct {
+		ch      chan LifecycleEvent
+		policy  DropPolicy
+		filter  func(*LifecycleEvent) bool
+		handle  func(*LifecycleEvent) // 内置订阅者在发布方 goroutine 中同步处理，不经过 ch
+		enabled func(*Task) bool      // 内置订阅者不需要时不构造事件
+		dropped atomic.Uint64
+		mux     sync.Mutex
+		closed  bool
+	}
+	// eventBus 全局生命周期事件总线，订阅者列表写时复制，无订阅者时发布几乎没有开销
+	eventBus struct {
+		mux  sync.Mutex
+		subs atomic.Pointer[[]*Subscription]
+	}
+)
+
+var lifecycle eventBus
+
+// logSubscription 默认订阅者，以 Debug 级别把生命周期事件写入任务自身的日志
+var logSubscription = &Subscription{handle: logEvent, enabled: (*Task).debugEnabled}
+
+func init() {
+	lifecycle.subs.Store(&[]*Subscription{logSubscription})
+}
+
+func (t LifecycleEventType) String() string {
+	switch t {
+	case EVENT_ADDED:
+		return "added"
+	case EVENT_STARTING:
+		return "starting"
+	case EVENT_STARTED:
+		return "started"
+	case EVENT_RUNNING:
+		return "running"
+	case EVENT_STOPPING:
+		return "stopping"
+	case EVENT_DISPOSING:
+		return "disposing"
+	case EVENT_DISPOSED:
+		return "disposed"
+	case EVENT_RETRY_SCHEDULED:
+		return "retryScheduled"
+	case EVENT_PANIC:
+		return "panic"
+	case EVENT_DESCRIPTION_CHANGED:
+		return "descriptionChanged"
+	default:
+		return "unknown"
+	}
+}
+
+// SubscribeEvents 订阅整个任务树的生命周期事件，bufferSize 为 0 时使用 DefaultEventBuffer
+// filter 为 nil 时接收所有事件
+func SubscribeEvents(bufferSize int, policy DropPolicy, filter func(*LifecycleEvent) bool) *Subscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultEventBuffer
+	}
+	sub := &Subscription{ch: make(chan LifecycleEvent, bufferSize), policy: policy, filter: filter}
+	lifecycle.mux.Lock()
+	defer lifecycle.mux.Unlock()
+	var subs []*Subscription
+	if old := lifecycle.subs.Load(); old != nil {
+		subs = append(subs, *old...)
+	}
+	subs = append(subs, sub)
+	lifecycle.subs.Store(&subs)
+	return sub
+}
+
+// SubscribeEvents 订阅 Job 后代任务的生命周期事件
+func (mt *Job) SubscribeEvents(bufferSize int, policy DropPolicy) *Subscription {
+	id := mt.GetTaskID()
+	return SubscribeEvents(bufferSize, policy, func(event *LifecycleEvent) bool {
+		return slices.Contains(event.Ancestors, id)
+	})
+}
+
+// Events 接收事件的通道，Close 后关闭
+func (s *Subscription) Events() <-chan LifecycleEvent {
+	return s.ch
+}
+
+// Dropped 因缓冲区满被丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close 取消订阅并关闭事件通道
+func (s *Subscription) Close() {
+	lifecycle.mux.Lock()
+	if old := lifecycle.subs.Load(); old != nil {
+		subs := make([]*Subscription, 0, len(*old))
+		for _, sub := range *old {
+			if sub != s {
+				subs = append(subs, sub)
+			}
+		}
+		lifecycle.subs.Store(&subs)
+	}
+	lifecycle.mux.Unlock()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func (s *Subscription) deliver(event *LifecycleEvent) {
+	if s.handle != nil {
+		if s.enabled(event.Task.GetTask()) {
+			s.handle(event)
+		}
+		return
+	}
+	if s.filter != nil && !s.filter(event) {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	for {
+		select {
+		case s.ch <- *event:
+			return
+		default:
+		}
+		if s.policy == DROP_NEWEST {
+			s.dropped.Add(1)
+			return
+		}
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// publish 向所有订阅者发布事件，fill 用于设置事件类型相关的字段
+func (task *Task) publish(eventType LifecycleEventType, fill func(*LifecycleEvent)) {
+	subs := lifecycle.subs.Load()
+	if subs == nil || task.handler == nil || !slices.ContainsFunc(*subs, func(sub *Subscription) bool {
+		return sub.enabled == nil || sub.enabled(task)
+	}) {
+		return
+	}
+	event := LifecycleEvent{
+		Type:      eventType,
+		Time:      time.Now(),
+		Task:      task.handler,
+		TaskID:    task.ID,
+		Ancestors: task.ancestors,
+		OwnerType: task.GetOwnerType(),
+		Level:     task.level,
+		State:     task.state,
+	}
+	if task.parent != nil {
+		event.ParentID = task.parent.ID
+	}
+	if fill != nil {
+		fill(&event)
+	}
+	for _, sub := range *subs {
+		sub.deliver(&event)
+	}
+}
+
+func (task *Task) publishCause(eventType LifecycleEventType, cause error) {
+	task.publish(eventType, func(event *LifecycleEvent) {
+		event.Cause = cause
+	})
+}
+
+func (task *Task) publishDescription(key string, value any) {
+	task.publish(EVENT_DESCRIPTION_CHANGED, func(event *LifecycleEvent) {
+		event.Key, event.Value = key, value
+	})
+}
+
+func (task *Task) debugEnabled() bool {
+	if task.Logger == nil {
+		return slog.Default().Enabled(task.Context, slog.LevelDebug)
+	}
+	return task.Logger.Enabled(task.Context, slog.LevelDebug)
+}
+
+// logEvent 记录任务的生命周期日志，panic 和重试已在发生处以 Error、Warn 级别记录
+func logEvent(event *LifecycleEvent) {
+	task := event.Task.GetTask()
+	args := []any{"taskId", event.TaskID, "taskType", event.Task.GetTaskType(), "ownerType", event.OwnerType}
+	switch event.Type {
+	case EVENT_ADDED:
+		task.Debug("task added", append(args, "parentId", event.ParentID)...)
+	case EVENT_STARTING:
+		task.Debug("task start", append(args, "reason", task.StartReason)...)
+	case EVENT_STARTED:
+		task.Debug("task started", args...)
+	case EVENT_RUNNING:
+		if event.State == TASK_STATE_GOING {
+			task.Debug("task go", args...)
+		} else {
+			task.Debug("task run", args...)
+		}
+	case EVENT_STOPPING:
+		msg := "task cancel context"
+		if event.State < TASK_STATE_STARTED {
+			msg = "task start failed"
+		}
+		task.Debug(msg, append(args, "caller", event.Caller, "reason", event.Cause, "elapsed", event.Time.Sub(task.StartTime))...)
+	case EVENT_DISPOSING:
+		task.Debug("task dispose", append(args, "reason", event.Cause)...)
+	case EVENT_DISPOSED:
+		task.Debug("task disposed", append(args, "reason", event.Cause)...)
+	}
+}
@@ -2,9 +2,11 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -44,6 +46,11 @@ type Job struct {
 	children                    sync.Map
 	descendantsDisposeListeners []func(ITask)
 	descendantsStartListeners   []func(ITask)
+	circuitStateListeners       []func(ITask, CircuitState)
+	disposeConfig               DisposeConfig
+	leaks                       disposeLeaks
+	draining                    atomic.Bool
+	drainNotify                 Singleton[chan struct{}]
 	blocked                     ITask
 	eventLoop                   EventLoop
 	Size                        atomic.Int32
@@ -65,18 +72,6 @@ func (mt *Job) EventLoopRunning() bool {
 	return mt.eventLoop.running.Load()
 }
 
-func (mt *Job) waitChildrenDispose(stopReason error) {
-	mt.eventLoop.active(mt)
-	mt.children.Range(func(key, value any) bool {
-		child := value.(ITask)
-		child.Stop(stopReason)
-		mt.SetDescription("waitChildDispose", child.GetTaskID())
-		child.WaitStopped()
-		mt.RemoveDescription("waitChildDispose")
-		return true
-	})
-}
-
 func (mt *Job) OnDescendantsDispose(listener func(ITask)) {
 	mt.descendantsDisposeListeners = append(mt.descendantsDisposeListeners, listener)
 }
@@ -96,13 +91,12 @@ func (mt *Job) onChildDispose(child ITask) {
 }
 
 func (mt *Job) removeChild(child ITask) {
-	value, loaded := mt.children.LoadAndDelete(child.getKey())
-	if loaded {
-		if value != child {
-			panic("remove child")
-		}
+	// 被替换的任务及尚未切换键映射的新任务不在 children 中，但仍计入 Size
+	if mt.children.CompareAndDelete(child.getKey(), child) || child.GetTask().detached.Swap(false) {
 		remains := mt.Size.Add(-1)
 		mt.Debug("remove child", "id", child.GetTaskID(), "remains", remains)
+		metrics().ChildCount(mt, int(remains))
+		mt.notifyDrain()
 	}
 }
 
@@ -119,6 +113,17 @@ func (mt *Job) onDescendantsStart(descendants ITask) {
 	}
 }
 
+// OnCircuitStateChange listens for circuit breaker state changes of children
+func (mt *Job) OnCircuitStateChange(listener func(ITask, CircuitState)) {
+	mt.circuitStateListeners = append(mt.circuitStateListeners, listener)
+}
+
+func (mt *Job) onCircuitStateChange(child ITask, state CircuitState) {
+	for _, listener := range mt.circuitStateListeners {
+		listener(child, state)
+	}
+}
+
 func (mt *Job) onChildStart(child ITask) {
 	mt.onDescendantsStart(child)
 }
@@ -138,6 +143,7 @@ func (mt *Job) AddDependTask(t ITask, opt ...any) (task *Task) {
 
 func (mt *Job) initContext(task *Task, opt ...any) {
 	callDepth := 2
+	task.depends, task.dependFail = nil, DEPEND_FAIL_STOP // 依赖只来自本次添加的选项
 	for _, o := range opt {
 		switch v := o.(type) {
 		case context.Context:
@@ -146,6 +152,16 @@ func (mt *Job) initContext(task *Task, opt ...any) {
 			task.SetDescriptions(v)
 		case RetryConfig:
 			task.retry = v
+		case TimeoutConfig:
+			task.timeout = v
+		case Dependency:
+			task.depends = append(task.depends, v)
+		case DependFailPolicy:
+			task.dependFail = v
+		case DisposeConfig:
+			if job, ok := task.handler.(IJob); ok {
+				job.getJob().disposeConfig = v
+			}
 		case *slog.Logger:
 			task.Logger = v
 		case int:
@@ -156,7 +172,16 @@ func (mt *Job) initContext(task *Task, opt ...any) {
 	if ok {
 		task.StartReason = fmt.Sprintf("%s:%d", strings.TrimPrefix(file, sourceFilePathPrefix), line)
 	}
+	if len(task.depends) > 0 {
+		depends := make([]string, len(task.depends))
+		for i, dep := range task.depends {
+			depends[i] = dep.String()
+		}
+		task.SetDescription(DependsOnKey, depends)
+		task.SetDescription(DependFailKey, task.dependFail.String())
+	}
 	task.parent = mt
+	task.ancestors = append([]uint32{mt.ID}, mt.ancestors...)
 	if task.parentCtx == nil {
 		task.parentCtx = mt.Context
 	}
@@ -165,8 +190,10 @@ func (mt *Job) initContext(task *Task, opt ...any) {
 		task.ID = GetNextTaskID()
 	}
 	task.Context, task.CancelCauseFunc = context.WithCancelCause(task.parentCtx)
-	task.startup = util.NewPromise(task.Context)
-	task.shutdown = util.NewPromise(context.Background())
+	task.Context = withTrace(task.Context)
+	task.startup = util.NewFutureWithContext[struct{}](task.Context)
+	task.shutdown = util.NewFuture[struct{}]()
+	task.removed = util.NewFuture[struct{}]()
 	if task.Logger == nil {
 		task.Logger = mt.Logger
 	}
@@ -176,25 +203,58 @@ func (mt *Job) AddTask(t ITask, opt ...any) (task *Task) {
 	task = t.GetTask()
 	task.handler = t
 	mt.initContext(task, opt...)
+	mt.addChild(nil, t)
+	return
+}
+
+// AddTaskWait 添加子任务，事件循环输入通道已满时等待空位，直到 ctx 结束或 Job 停止
+func (mt *Job) AddTaskWait(ctx context.Context, t ITask, opt ...any) (task *Task) {
+	task = t.GetTask()
+	task.handler = t
+	mt.initContext(task, opt...)
+	mt.addChild(ctx, t)
+	return
+}
+
+func (mt *Job) addChild(ctx context.Context, t ITask) {
+	task := t.GetTask()
+	var err error
 	if mt.IsStopped() {
-		task.startup.Reject(mt.StopReason())
+		err = mt.StopReason()
+		task.startup.Reject(err)
+		task.terminate(err)
+		return
+	}
+	if mt.draining.Load() {
+		err = ErrDraining
+		task.startup.Reject(err)
+		task.terminate(err)
+		return
+	}
+	if err = mt.checkDepends(task); err != nil {
+		task.startup.Reject(err)
+		task.terminate(err)
 		return
 	}
 	actual, loaded := mt.children.LoadOrStore(t.getKey(), t)
 	if loaded {
-		task.startup.Reject(ExistTaskError{
+		err = ExistTaskError{
 			Task: actual.(ITask),
-		})
+		}
+		task.startup.Reject(err)
+		task.terminate(err)
 		return
 	}
-	var err error
+	task.publish(EVENT_ADDED, nil) // 在投递到事件循环之前发布，保证先于 EVENT_STARTING
 	defer func() {
 		if err != nil {
-			mt.children.Delete(t.getKey())
+			mt.children.CompareAndDelete(t.getKey(), t)
 			task.startup.Reject(err)
+			task.terminate(err)
+			task.publishCause(EVENT_DISPOSED, err)
 		}
 	}()
-	if err = mt.eventLoop.add(mt, t); err != nil {
+	if err = mt.eventLoop.send(ctx, mt, t); err != nil {
 		return
 	}
 	if mt.IsStopped() {
@@ -203,7 +263,17 @@ func (mt *Job) AddTask(t ITask, opt ...any) (task *Task) {
 	}
 	remains := mt.Size.Add(1)
 	mt.Debug("child added", "id", task.ID, "remains", remains)
-	return
+	metrics().ChildCount(mt, int(remains))
+}
+
+// SetInputCapacity 设置事件循环输入通道容量，需在添加第一个子任务或调用 Call 之前设置
+func (mt *Job) SetInputCapacity(capacity int) {
+	mt.eventLoop.capacity = capacity
+}
+
+// EventLoopStats 获取事件循环队列统计，用于调整输入通道容量
+func (mt *Job) EventLoopStats() EventLoopStats {
+	return mt.eventLoop.stats()
 }
 
 func (mt *Job) Call(callback func()) {
@@ -226,3 +296,47 @@ func (mt *Job) Call(callback func()) {
 	})
 	<-ctx.Done()
 }
+
+// CallAsync 在事件循环中执行 callback 并返回结果的 Future，ctx 在执行前结束时跳过 callback
+func CallAsync[T any](ctx context.Context, job IJob, callback func() (T, error)) *util.Future[T] {
+	return callAsync(ctx, job, callback)
+}
+
+// CallWithResult 在事件循环中执行 callback 并等待结果
+func CallWithResult[T any](ctx context.Context, job IJob, callback func() (T, error)) (T, error) {
+	return callAsync(ctx, job, callback).Await(ctx)
+}
+
+func callAsync[T any](ctx context.Context, job IJob, callback func() (T, error)) *util.Future[T] {
+	mt := job.getJob()
+	_, file, line, _ := runtime.Caller(2)
+	caller := fmt.Sprintf("%s:%d", strings.TrimPrefix(file, sourceFilePathPrefix), line)
+	future := util.NewFuture[T]()
+	call := func() {
+		if err := context.Cause(ctx); err != nil {
+			future.Reject(err)
+			return
+		}
+		startTime := time.Now()
+		mt.Debug("call async", "caller", caller)
+		defer func() {
+			if !ThrowPanic {
+				if r := recover(); r != nil {
+					err := errors.New(fmt.Sprint(r))
+					mt.Error("call async panic", "caller", caller, "error", err, "stack", string(debug.Stack()))
+					future.Reject(err)
+				}
+			}
+			mt.Debug("call async done", "caller", caller, "elapsed", time.Since(startTime))
+		}()
+		if value, err := callback(); err != nil {
+			future.Reject(err)
+		} else {
+			future.Resolve(value)
+		}
+	}
+	if err := mt.eventLoop.send(ctx, mt, call); err != nil {
+		future.Reject(err)
+	}
+	return future
+}
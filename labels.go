@@ -0,0 +1,44 @@
+package task
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// pprof 标签名，框架启动的 goroutine 都带有所属任务的标签，可按任务对 goroutine 和 CPU profile 分组
+const (
+	LabelTaskID    = "taskId"
+	LabelOwnerType = "ownerType"
+	LabelLevel     = "level"
+	LabelParentID  = "parentId"
+)
+
+// PprofLabels 获取任务的 pprof 标签，根任务的 parentId 为 0
+func (task *Task) PprofLabels() pprof.LabelSet {
+	var parentID uint32
+	if task.parent != nil {
+		parentID = task.parent.ID
+	}
+	return pprof.Labels(
+		LabelTaskID, strconv.FormatUint(uint64(task.ID), 10),
+		LabelOwnerType, task.GetOwnerType(),
+		LabelLevel, strconv.Itoa(int(task.level)),
+		LabelParentID, strconv.FormatUint(uint64(parentID), 10),
+	)
+}
+
+// GoWithLabels 在带有任务 pprof 标签的新 goroutine 中执行 f，用于在任务内启动用户 goroutine
+// f 收到的 ctx 派生自任务的 context 并携带标签，任务停止时 ctx 随之取消
+func (task *Task) GoWithLabels(f func(ctx context.Context)) {
+	ctx, labels := task.Context, task.PprofLabels() // 在调用方 goroutine 中读取，避免与任务状态变化竞争
+	go pprof.Do(ctx, labels, f)
+}
+
+// goWithLabels 框架内部启动属于任务的 goroutine
+func (task *Task) goWithLabels(f func()) {
+	labels := task.PprofLabels()
+	go pprof.Do(context.Background(), labels, func(context.Context) {
+		f()
+	})
+}
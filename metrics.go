@@ -0,0 +1,222 @@
+package task
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/langhuihui/gotask/util"
+)
+
+// DefaultLifetimeBuckets 任务存活时长的默认分桶上限
+var DefaultLifetimeBuckets = []time.Duration{
+	100 * time.Millisecond, time.Second, 10 * time.Second, time.Minute,
+	10 * time.Minute, time.Hour, 24 * time.Hour,
+}
+
+type (
+	// MetricsSink 任务生命周期指标接收器，方法会在任务和事件循环的 goroutine 中并发调用，实现需快速返回
+	MetricsSink interface {
+		TaskStarted(task ITask)                                     // Start 成功
+		TaskEnded(task ITask, reason error, lifetime time.Duration) // 任务停止（含启动失败），每次启动对应一次
+		TaskRetried(task ITask)                                     // 停止后被安排重试
+		TaskPanicked(task ITask)                                    // Start、Run、Go、Tick 或事件循环发生 panic
+		TaskDisposed(task ITask, elapsed time.Duration)             // 销毁完成，elapsed 为销毁耗时
+		QueueDepth(job IJob, depth int)                             // 事件循环待处理的输入和通知数量，仅在数量变化时调用
+		ChildCount(job IJob, count int)                             // Job 子任务数量变化
+	}
+	// OwnerMetrics 按 OwnerType 聚合的任务指标
+	OwnerMetrics struct {
+		Started, Completed, Failed, Retried, Panicked uint64
+		Lifetime, Dispose                             *util.Histogram
+	}
+	// JobMetrics 单个 Job 的事件循环和子任务指标
+	JobMetrics struct {
+		OwnerType     string
+		Level         byte
+		Children      int
+		QueueDepth    int
+		MaxQueueDepth int
+	}
+	// MetricsSnapshot MemoryMetrics 的快照
+	MetricsSnapshot struct {
+		Owners map[string]OwnerMetrics
+		Jobs   map[uint32]JobMetrics
+	}
+	// MemoryMetrics 内存中的默认指标接收器
+	MemoryMetrics struct {
+		owners sync.Map // ownerType -> *ownerCounters
+		jobs   sync.Map // jobId -> *jobGauges
+	}
+	ownerCounters struct {
+		started, completed, failed, retried, panicked atomic.Uint64
+		lifetime, dispose                             *util.Histogram
+	}
+	jobGauges struct {
+		ownerType                 string
+		level                     byte
+		children, depth, maxDepth atomic.Int32
+	}
+	metricsHolder struct {
+		MetricsSink
+	}
+	noopMetrics struct{}
+)
+
+// DefaultMetrics 默认启用的内存指标接收器
+var DefaultMetrics = NewMemoryMetrics()
+
+var metricsSink atomic.Pointer[metricsHolder]
+
+func init() {
+	SetMetricsSink(DefaultMetrics)
+}
+
+// SetMetricsSink 替换全局指标接收器，传入 nil 关闭指标收集
+func SetMetricsSink(sink MetricsSink) {
+	if sink == nil {
+		sink = noopMetrics{}
+	}
+	metricsSink.Store(&metricsHolder{sink})
+}
+
+func metrics() MetricsSink {
+	return metricsSink.Load().MetricsSink
+}
+
+// isFailure 判断停止原因是否为失败，正常完成、用户停止、自动停止和重启不算失败
+func isFailure(reason error) bool {
+	return !(errors.Is(reason, ErrTaskComplete) || errors.Is(reason, ErrExit) || errors.Is(reason, ErrStopByUser) ||
+		errors.Is(reason, ErrAutoStop) || errors.Is(reason, ErrRestart))
+}
+
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{}
+}
+
+func (m *MemoryMetrics) owner(task ITask) *ownerCounters {
+	ownerType := task.GetOwnerType()
+	if v, ok := m.owners.Load(ownerType); ok {
+		return v.(*ownerCounters)
+	}
+	v, _ := m.owners.LoadOrStore(ownerType, &ownerCounters{
+		lifetime: util.NewHistogram(DefaultLifetimeBuckets...),
+		dispose:  util.NewHistogram(),
+	})
+	return v.(*ownerCounters)
+}
+
+// job 按 ID 获取 Job 的指标，只读取不会被 reset 改写的字段，Job 销毁后由 TaskDisposed 删除
+func (m *MemoryMetrics) job(job IJob) *jobGauges {
+	id := job.GetTaskID()
+	if v, ok := m.jobs.Load(id); ok {
+		return v.(*jobGauges)
+	}
+	v, _ := m.jobs.LoadOrStore(id, &jobGauges{ownerType: job.GetOwnerType(), level: job.GetLevel()})
+	return v.(*jobGauges)
+}
+
+func (m *MemoryMetrics) TaskStarted(task ITask) {
+	m.owner(task).started.Add(1)
+}
+
+func (m *MemoryMetrics) TaskEnded(task ITask, reason error, lifetime time.Duration) {
+	owner := m.owner(task)
+	if isFailure(reason) {
+		owner.failed.Add(1)
+	} else {
+		owner.completed.Add(1)
+	}
+	owner.lifetime.Observe(lifetime)
+}
+
+func (m *MemoryMetrics) TaskRetried(task ITask) {
+	m.owner(task).retried.Add(1)
+}
+
+func (m *MemoryMetrics) TaskPanicked(task ITask) {
+	m.owner(task).panicked.Add(1)
+}
+
+func (m *MemoryMetrics) TaskDisposed(task ITask, elapsed time.Duration) {
+	m.owner(task).dispose.Observe(elapsed)
+	if _, ok := task.(IJob); ok {
+		m.jobs.Delete(task.GetTaskID())
+	}
+}
+
+func (m *MemoryMetrics) QueueDepth(job IJob, depth int) {
+	gauges := m.job(job)
+	gauges.depth.Store(int32(depth))
+	for maxDepth := gauges.maxDepth.Load(); int32(depth) > maxDepth; maxDepth = gauges.maxDepth.Load() {
+		if gauges.maxDepth.CompareAndSwap(maxDepth, int32(depth)) {
+			break
+		}
+	}
+}
+
+func (m *MemoryMetrics) ChildCount(job IJob, count int) {
+	m.job(job).children.Store(int32(count))
+}
+
+// Owner 获取指定 OwnerType 的指标，不存在时返回零值
+func (m *MemoryMetrics) Owner(ownerType string) (metrics OwnerMetrics) {
+	if v, ok := m.owners.Load(ownerType); ok {
+		metrics = v.(*ownerCounters).snapshot()
+	}
+	return
+}
+
+// Job 获取指定 Job 的指标，Job 销毁后不再保留
+func (m *MemoryMetrics) Job(id uint32) (metrics JobMetrics, ok bool) {
+	var v any
+	if v, ok = m.jobs.Load(id); ok {
+		metrics = v.(*jobGauges).snapshot()
+	}
+	return
+}
+
+// Snapshot 获取所有指标的快照，直方图为共享引用
+func (m *MemoryMetrics) Snapshot() (snapshot MetricsSnapshot) {
+	snapshot.Owners, snapshot.Jobs = make(map[string]OwnerMetrics), make(map[uint32]JobMetrics)
+	m.owners.Range(func(key, value any) bool {
+		snapshot.Owners[key.(string)] = value.(*ownerCounters).snapshot()
+		return true
+	})
+	m.jobs.Range(func(key, value any) bool {
+		snapshot.Jobs[key.(uint32)] = value.(*jobGauges).snapshot()
+		return true
+	})
+	return
+}
+
+func (c *ownerCounters) snapshot() OwnerMetrics {
+	return OwnerMetrics{
+		Started:   c.started.Load(),
+		Completed: c.completed.Load(),
+		Failed:    c.failed.Load(),
+		Retried:   c.retried.Load(),
+		Panicked:  c.panicked.Load(),
+		Lifetime:  c.lifetime,
+		Dispose:   c.dispose,
+	}
+}
+
+func (g *jobGauges) snapshot() JobMetrics {
+	return JobMetrics{
+		OwnerType:     g.ownerType,
+		Level:         g.level,
+		Children:      int(g.children.Load()),
+		QueueDepth:    int(g.depth.Load()),
+		MaxQueueDepth: int(g.maxDepth.Load()),
+	}
+}
+
+func (noopMetrics) TaskStarted(ITask)                     {}
+func (noopMetrics) TaskEnded(ITask, error, time.Duration) {}
+func (noopMetrics) TaskRetried(ITask)                     {}
+func (noopMetrics) TaskPanicked(ITask)                    {}
+func (noopMetrics) TaskDisposed(ITask, time.Duration)     {}
+func (noopMetrics) QueueDepth(IJob, int)                  {}
+func (noopMetrics) ChildCount(IJob, int)                  {}
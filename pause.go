@@ -0,0 +1,44 @@
+package task
+
+// Pause 暂停任务，Job 会先暂停所有子任务，暂停不会销毁资源
+// 仅对已启动且未停止的任务生效，返回是否由本次调用暂停
+func (task *Task) Pause() bool {
+	if task.IsStopped() || task.startup == nil || !task.startup.IsResolved() || !task.paused.CompareAndSwap(false, true) {
+		return false
+	}
+	task.SetDescription(PausedKey, true)
+	if job, ok := task.handler.(IJob); ok {
+		job.RangeSubTask(func(child ITask) bool {
+			child.Pause()
+			return true
+		})
+	}
+	if v, ok := task.handler.(Pausable); ok {
+		v.OnPause()
+	}
+	task.Info("task paused", "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType())
+	return true
+}
+
+// Resume 恢复暂停的任务，Job 会在自身恢复后再恢复所有子任务，返回是否由本次调用恢复
+func (task *Task) Resume() bool {
+	if !task.paused.CompareAndSwap(true, false) {
+		return false
+	}
+	task.RemoveDescription(PausedKey)
+	if v, ok := task.handler.(Pausable); ok {
+		v.OnResume()
+	}
+	if job, ok := task.handler.(IJob); ok {
+		job.RangeSubTask(func(child ITask) bool {
+			child.Resume()
+			return true
+		})
+	}
+	task.Info("task resumed", "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType())
+	return true
+}
+
+func (task *Task) IsPaused() bool {
+	return task.paused.Load()
+}
@@ -0,0 +1,183 @@
+package task
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/langhuihui/gotask/util"
+)
+
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler 以 Prometheus 文本格式输出任务指标
+// 任务数量、子任务数量和事件循环队列深度来自遍历 Root 下的任务树，启动、完成、失败、重试、panic 计数和时长分布来自 Metrics
+type PrometheusHandler struct {
+	Root      IJob
+	Metrics   *MemoryMetrics // 为 nil 时使用 DefaultMetrics
+	Namespace string         // 指标名前缀，为空时使用 gotask
+}
+
+type (
+	taskCountKey struct {
+		state     string
+		ownerType string
+		level     byte
+	}
+	promWriter struct {
+		*bufio.Writer
+		namespace string
+	}
+)
+
+// NewPrometheusHandler 创建输出 root 任务树及 DefaultMetrics 的 Prometheus 指标处理器
+func NewPrometheusHandler(root IJob) *PrometheusHandler {
+	return &PrometheusHandler{Root: root}
+}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", PrometheusContentType)
+	out := promWriter{bufio.NewWriter(w), util.Conditional(h.Namespace != "", h.Namespace, "gotask")}
+	defer out.Flush()
+	h.writeTree(out)
+	h.writeMetrics(out)
+}
+
+func (h *PrometheusHandler) writeTree(out promWriter) {
+	counts := make(map[taskCountKey]int)
+	var jobs []IJob
+	var walk func(t ITask)
+	walk = func(t ITask) {
+		counts[taskCountKey{taskStateName(t.GetState()), t.GetOwnerType(), t.GetLevel()}]++
+		if job, ok := t.(IJob); ok {
+			jobs = append(jobs, job)
+			job.RangeSubTask(func(child ITask) bool {
+				walk(child)
+				return true
+			})
+		}
+	}
+	walk(h.Root)
+	out.header("tasks", "gauge", "Number of live tasks by state, owner type and level.")
+	for _, key := range slices.SortedFunc(maps.Keys(counts), func(a, b taskCountKey) int {
+		return cmp.Or(cmp.Compare(a.level, b.level), strings.Compare(a.ownerType, b.ownerType), strings.Compare(a.state, b.state))
+	}) {
+		out.sample("tasks", counts[key], "state", key.state, "owner_type", key.ownerType, "level", strconv.Itoa(int(key.level)))
+	}
+	out.header("job_children", "gauge", "Number of children of each job.")
+	for _, job := range jobs {
+		out.sample("job_children", job.getJob().Size.Load(), job.getJob().jobLabels()...)
+	}
+	out.header("event_loop_queue_depth", "gauge", "Pending inputs and notifications of each job's event loop.")
+	for _, job := range jobs {
+		stats := job.getJob().EventLoopStats()
+		out.sample("event_loop_queue_depth", stats.Depth+stats.Pending, job.getJob().jobLabels()...)
+	}
+}
+
+func (h *PrometheusHandler) writeMetrics(out promWriter) {
+	m := h.Metrics
+	if m == nil {
+		m = DefaultMetrics
+	}
+	owners := m.Snapshot().Owners
+	ownerTypes := slices.Sorted(maps.Keys(owners))
+	counters := []struct {
+		name, help string
+		value      func(OwnerMetrics) uint64
+	}{
+		{"task_started_total", "Total successful task starts.", func(o OwnerMetrics) uint64 { return o.Started }},
+		{"task_completed_total", "Total task stops that were not failures.", func(o OwnerMetrics) uint64 { return o.Completed }},
+		{"task_failed_total", "Total task stops caused by failures, including failed starts.", func(o OwnerMetrics) uint64 { return o.Failed }},
+		{"task_retries_total", "Total retries scheduled.", func(o OwnerMetrics) uint64 { return o.Retried }},
+		{"task_panics_total", "Total panics recovered in tasks and event loops.", func(o OwnerMetrics) uint64 { return o.Panicked }},
+	}
+	for _, counter := range counters {
+		out.header(counter.name, "counter", counter.help)
+		for _, ownerType := range ownerTypes {
+			out.sample(counter.name, counter.value(owners[ownerType]), "owner_type", ownerType)
+		}
+	}
+	out.header("task_dispose_duration_seconds", "histogram", "Time spent disposing tasks.")
+	for _, ownerType := range ownerTypes {
+		out.histogram("task_dispose_duration_seconds", owners[ownerType].Dispose, "owner_type", ownerType)
+	}
+	out.header("task_lifetime_seconds", "histogram", "Time from start to stop of tasks.")
+	for _, ownerType := range ownerTypes {
+		out.histogram("task_lifetime_seconds", owners[ownerType].Lifetime, "owner_type", ownerType)
+	}
+}
+
+func (mt *Job) jobLabels() []string {
+	return []string{"job_id", strconv.FormatUint(uint64(mt.ID), 10), "owner_type", mt.GetOwnerType(), "level", strconv.Itoa(int(mt.level))}
+}
+
+func (out promWriter) header(name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", out.namespace, name, help, out.namespace, name, kind)
+}
+
+func (out promWriter) sample(name string, value any, labels ...string) {
+	out.WriteString(out.namespace + "_" + name)
+	if len(labels) > 0 {
+		out.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		out.WriteByte('}')
+	}
+	fmt.Fprintf(out, " %v\n", value)
+}
+
+func (out promWriter) histogram(name string, h *util.Histogram, labels ...string) {
+	for _, bucket := range h.Buckets() {
+		le := "+Inf"
+		if bucket.Le > 0 {
+			le = formatSeconds(bucket.Le)
+		}
+		out.sample(name+"_bucket", bucket.Count, append(labels[:len(labels):len(labels)], "le", le)...)
+	}
+	out.sample(name+"_sum", formatSeconds(h.Sum()), labels...)
+	out.sample(name+"_count", h.Count(), labels...)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func taskStateName(state TaskState) string {
+	switch state {
+	case TASK_STATE_INIT:
+		return "init"
+	case TASK_STATE_STARTING:
+		return "starting"
+	case TASK_STATE_STARTED:
+		return "started"
+	case TASK_STATE_RUNNING:
+		return "running"
+	case TASK_STATE_GOING:
+		return "going"
+	case TASK_STATE_DISPOSING:
+		return "disposing"
+	case TASK_STATE_DISPOSED:
+		return "disposed"
+	case TASK_STATE_PAUSED:
+		return "paused"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,137 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	REPLACE_START_BEFORE_STOP ReplaceOrder = iota // 新任务启动成功时切换键映射，随后停止旧任务
+	REPLACE_STOP_BEFORE_START                     // 旧任务销毁完成时切换键映射，随后启动新任务
+)
+
+var (
+	ErrReplaced     = fmt.Errorf("replaced %w", ErrStopByUser)
+	ErrTaskNotFound = errors.New("task not found")
+)
+
+// ReplaceOrder 替换任务时新旧任务的启停顺序
+type ReplaceOrder byte
+
+// replaceTask 用 t 替换键相同的子任务，键的查找与切换都在事件循环中进行，与子任务的移除串行
+func (mt *Job) replaceTask(t ITask, order ReplaceOrder, upsert bool, opt ...any) (task *Task) {
+	task = t.GetTask()
+	task.handler = t
+	mt.initContext(task, append(opt, 1)...)
+	reject := func(err error) {
+		task.startup.Reject(err)
+		task.terminate(err)
+	}
+	if mt.IsStopped() {
+		reject(mt.StopReason())
+		return
+	}
+	if mt.draining.Load() {
+		reject(ErrDraining)
+		return
+	}
+	if err := mt.checkDepends(task); err != nil {
+		reject(err)
+		return
+	}
+	if err := mt.eventLoop.add(mt, func() {
+		mt.eventLoop.replace(mt, t, order, upsert)
+	}); err != nil {
+		reject(err)
+	}
+	return
+}
+
+func (e *EventLoop) replace(mt *Job, t ITask, order ReplaceOrder, upsert bool) {
+	task := t.GetTask()
+	reject := func(err error) {
+		task.startup.Reject(err)
+		task.terminate(err)
+	}
+	if mt.IsStopped() {
+		reject(mt.StopReason())
+		return
+	}
+	key := t.getKey()
+	value, loaded := mt.children.LoadOrStore(key, t)
+	if !loaded {
+		if !upsert {
+			mt.children.CompareAndDelete(key, t)
+			reject(ErrTaskNotFound)
+			return
+		}
+		mt.Size.Add(1)
+		task.publish(EVENT_ADDED, nil)
+		e.startChild(mt, t)
+		return
+	}
+	old := value.(ITask)
+	if old == t {
+		reject(ExistTaskError{Task: old})
+		return
+	}
+	mt.Info("replace child", "key", key, "oldId", old.GetTaskID(), "newId", task.ID, "order", order)
+	switch order {
+	case REPLACE_STOP_BEFORE_START:
+		if pending := old.GetTask().replacedBy; pending != nil { // 旧任务尚未销毁完成，之前等待接替的新任务不再启动
+			pending.GetTask().startup.Reject(ErrReplaced)
+			pending.GetTask().terminate(ErrReplaced)
+		}
+		old.GetTask().replacedBy = t
+		old.Stop(ErrReplaced)
+	default:
+		task.replaces = old
+		task.detached.Store(true)
+		mt.Size.Add(1)
+		task.publish(EVENT_ADDED, nil)
+		e.startChild(mt, t)
+	}
+}
+
+// switchReplaced 新任务启动成功后把键映射切换过来并停止旧任务
+func (e *EventLoop) switchReplaced(mt *Job, child ITask) {
+	task := child.GetTask()
+	old := task.replaces
+	task.replaces = nil
+	key := child.getKey()
+	if mt.children.CompareAndSwap(key, old, child) {
+		old.GetTask().detached.Store(true)
+		task.detached.Store(false)
+		old.Stop(ErrReplaced)
+	} else if _, loaded := mt.children.LoadOrStore(key, child); !loaded { // 旧任务已经移除
+		task.detached.Store(false)
+	} else {
+		child.Stop(ExistTaskError{Task: child})
+	}
+}
+
+// handoff 旧任务销毁后把键映射直接交给替换它的新任务，Job 已停止时拒绝新任务
+func (e *EventLoop) handoff(mt *Job, old ITask) {
+	next := old.GetTask().replacedBy
+	old.GetTask().replacedBy = nil
+	if !mt.IsStopped() && mt.children.CompareAndSwap(old.getKey(), old, next) {
+		old.GetTask().detached.Store(true)
+		mt.Size.Add(1)
+		next.GetTask().publish(EVENT_ADDED, nil)
+		e.startChild(mt, next)
+		return
+	}
+	err := mt.StopReason()
+	if err == nil {
+		err = ErrTaskNotFound
+	}
+	next.GetTask().startup.Reject(err)
+	next.GetTask().terminate(err)
+}
+
+func (p ReplaceOrder) String() string {
+	if p == REPLACE_STOP_BEFORE_START {
+		return "stop-before-start"
+	}
+	return "start-before-stop"
+}
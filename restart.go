@@ -0,0 +1,78 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/langhuihui/gotask/util"
+)
+
+const (
+	RestartCountKey  = "restartCount"
+	RestartReasonKey = "restartReason"
+)
+
+// restartRequest 待处理的重启请求，started 在重启后的启动完成时完成
+type restartRequest struct {
+	reason  error
+	started *util.Future[struct{}]
+}
+
+// Restart 销毁任务并以相同的 ID 重新执行 Start、Run 和 Go
+// 与重试不同，重启总会发生（除非父任务已停止），且不消耗重试次数；仅对已启动且未停止的任务生效
+// 返回重启后启动结果的 Future，请求被拒绝时返回 nil
+func (task *Task) Restart(reason error) *util.Future[struct{}] {
+	if reason == nil {
+		reason = ErrRestart
+	}
+	if task.parent == nil || task.state < TASK_STATE_STARTED || task.IsStopped() {
+		return nil
+	}
+	req := &restartRequest{reason: reason, started: util.NewFuture[struct{}]()}
+	if !task.restartRequest.CompareAndSwap(nil, req) {
+		return nil
+	}
+	if errors.Is(reason, ErrRestart) {
+		task.Stop(reason)
+	} else {
+		task.Stop(fmt.Errorf("%w: %w", ErrRestart, reason))
+	}
+	if !errors.Is(task.StopReason(), ErrRestart) { // 已被其他原因停止
+		task.restartRequest.CompareAndSwap(req, nil)
+		return nil
+	}
+	return req.started
+}
+
+// RestartCount 获取通过 Restart 重启的次数
+func (task *Task) RestartCount() uint32 {
+	return task.restartCount.Load()
+}
+
+// restarted 在任务销毁后消费重启请求，记录次数和原因并重置任务，返回 true 时由调用方重新启动
+func (task *Task) restarted() bool {
+	req := task.restartRequest.Swap(nil)
+	if req == nil {
+		return false
+	}
+	if task.parent.IsStopped() {
+		req.started.Reject(task.parent.StopReason())
+		return false
+	}
+	count := task.restartCount.Add(1)
+	task.SetDescription(RestartCountKey, count)
+	task.SetDescription(RestartReasonKey, req.reason.Error())
+	task.Info("task restart", "taskId", task.ID, "count", count, "reason", req.reason)
+	task.reset()
+	task.startup.OnComplete(func(_ struct{}, err error) {
+		req.started.Complete(struct{}{}, err)
+	})
+	return true
+}
+
+// abandonRestart 任务不再重启时拒绝未处理的重启请求
+func (task *Task) abandonRestart(err error) {
+	if req := task.restartRequest.Swap(nil); req != nil {
+		req.started.Reject(err)
+	}
+}
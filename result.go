@@ -0,0 +1,84 @@
+package task
+
+import (
+	"sync"
+
+	"github.com/langhuihui/gotask/util"
+)
+
+type (
+	// ResultBlock 同步执行并产生结果，对应 TaskBlock
+	ResultBlock[T any] interface {
+		Run() (T, error)
+	}
+	// ResultGo 异步执行并产生结果，对应 TaskGo
+	ResultGo[T any] interface {
+		Go() (T, error)
+	}
+	// IResultTask 可产生结果的任务接口
+	IResultTask[T any] interface {
+		ITask
+		Result() *util.Future[T]
+		WaitResult() (T, error)
+	}
+	// taskResult 由 ResultTask 实现，供 Task.start 识别带结果的 Run/Go
+	taskResult interface {
+		resultRun() func() error
+		resultGo() func() error
+		finish(error)
+	}
+	// ResultTask 可产生结果的任务，嵌入后实现 Run() (T, error) 或 Go() (T, error)
+	// 成功返回的结果通过 Result 或 WaitResult 获取，任务最终失败时以停止原因拒绝
+	ResultTask[T any] struct {
+		Task
+		resultOnce sync.Once
+		result     *util.Future[T]
+	}
+)
+
+// Result 获取任务结果的 Future
+func (t *ResultTask[T]) Result() *util.Future[T] {
+	t.resultOnce.Do(func() {
+		t.result = util.NewFuture[T]()
+	})
+	return t.result
+}
+
+// WaitResult 等待任务产生结果
+func (t *ResultTask[T]) WaitResult() (T, error) {
+	return t.Result().Wait()
+}
+
+func (t *ResultTask[T]) resultRun() func() error {
+	if h, ok := t.handler.(ResultBlock[T]); ok {
+		return t.wrap(h.Run)
+	}
+	return nil
+}
+
+func (t *ResultTask[T]) resultGo() func() error {
+	if h, ok := t.handler.(ResultGo[T]); ok {
+		return t.wrap(h.Go)
+	}
+	return nil
+}
+
+func (t *ResultTask[T]) wrap(handler func() (T, error)) func() error {
+	return func() error {
+		value, err := handler()
+		if err == nil {
+			t.Result().Resolve(value)
+		}
+		return err
+	}
+}
+
+func (t *ResultTask[T]) finish(err error) {
+	t.Result().Reject(err)
+}
+
+// RunTaskWithResult 同步运行子任务并返回其结果
+func RunTaskWithResult[T any](parent ITask, t IResultTask[T], opt ...any) (T, error) {
+	_ = parent.GetTask().RunTask(t, append(opt, 1)...)
+	return t.WaitResult()
+}
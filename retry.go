@@ -0,0 +1,138 @@
+package task
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+type (
+	// RetryPolicy decides how long to wait before the next retry of a failed task.
+	// attempt starts at 1 for the first retry, err is the stop reason of the failed run.
+	// Returning ok=false gives up retrying for this err.
+	RetryPolicy interface {
+		NextDelay(config *RetryConfig, attempt int, err error) (delay time.Duration, ok bool)
+	}
+	// RetryPolicyFunc adapts a function to RetryPolicy
+	RetryPolicyFunc func(config *RetryConfig, attempt int, err error) (time.Duration, bool)
+	// ExponentialBackoff waits RetryInterval * 2^(attempt-1), capped by MaxRetryInterval (default policy)
+	ExponentialBackoff struct{}
+	// ConstantBackoff always waits RetryInterval
+	ConstantBackoff struct{}
+	// LinearBackoff waits RetryInterval * attempt, capped by MaxRetryInterval
+	LinearBackoff struct{}
+	// FullJitterBackoff waits a random duration in [0, exponential delay)
+	FullJitterBackoff struct{}
+	// DecorrelatedJitterBackoff waits a random duration in [RetryInterval, last delay * 3), capped by MaxRetryInterval
+	DecorrelatedJitterBackoff struct{}
+)
+
+var defaultRetryPolicy RetryPolicy = ExponentialBackoff{}
+
+func (f RetryPolicyFunc) NextDelay(config *RetryConfig, attempt int, err error) (time.Duration, bool) {
+	return f(config, attempt, err)
+}
+
+func (ExponentialBackoff) NextDelay(config *RetryConfig, attempt int, _ error) (time.Duration, bool) {
+	return exponentialDelay(config, attempt), true
+}
+
+func (ConstantBackoff) NextDelay(config *RetryConfig, _ int, _ error) (time.Duration, bool) {
+	return config.RetryInterval, true
+}
+
+func (LinearBackoff) NextDelay(config *RetryConfig, attempt int, _ error) (time.Duration, bool) {
+	return config.capDelay(config.RetryInterval * time.Duration(attempt)), true
+}
+
+func (FullJitterBackoff) NextDelay(config *RetryConfig, attempt int, _ error) (time.Duration, bool) {
+	return randDuration(0, exponentialDelay(config, attempt)), true
+}
+
+func (DecorrelatedJitterBackoff) NextDelay(config *RetryConfig, _ int, _ error) (time.Duration, bool) {
+	upper := config.lastDelay * 3
+	if upper < config.RetryInterval {
+		upper = config.RetryInterval
+	}
+	return config.capDelay(randDuration(config.RetryInterval, upper)), true
+}
+
+// exponentialDelay calculates baseInterval * 2^(attempt-1)
+func exponentialDelay(config *RetryConfig, attempt int) time.Duration {
+	if attempt <= 1 {
+		return config.RetryInterval
+	}
+	// Calculate 2^(attempt-1) using bit shift for better performance
+	exponent := attempt - 1
+	if exponent > 30 { // Avoid overflow for very large retry counts
+		exponent = 30
+	}
+	return config.capDelay(config.RetryInterval * time.Duration(1<<exponent))
+}
+
+func randDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + rand.N(max-min)
+}
+
+// capDelay applies the maximum delay limit if set
+func (config *RetryConfig) capDelay(delay time.Duration) time.Duration {
+	if config.MaxRetryInterval > 0 && delay > config.MaxRetryInterval {
+		return config.MaxRetryInterval
+	}
+	return delay
+}
+
+func (config *RetryConfig) policy() RetryPolicy {
+	if config.Policy != nil {
+		return config.Policy
+	}
+	return defaultRetryPolicy
+}
+
+// LastDelay returns the delay used before the latest retry
+func (config *RetryConfig) LastDelay() time.Duration {
+	return config.lastDelay
+}
+
+const (
+	ErrorClassKey    = "errorClass"
+	NoRetryReasonKey = "noRetryReason"
+
+	ErrorClassTerminal  = "terminal"
+	ErrorClassPermanent = "permanent"
+	ErrorClassRetryable = "retryable"
+)
+
+// PermanentError marks a stop reason that must not be retried
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err so that checkRetry never retries it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err is marked by Permanent
+func IsPermanent(err error) bool {
+	var permanent PermanentError
+	return errors.As(err, &permanent)
+}
+
+func (config *RetryConfig) isPermanent(err error) bool {
+	return IsPermanent(err) || (config.Retryable != nil && !config.Retryable(err))
+}
@@ -33,7 +33,7 @@ func (o *OSSignal) Start() error {
 }
 
 func (o *OSSignal) Tick(any) {
-	go o.root.Shutdown()
+	o.goWithLabels(o.root.Shutdown)
 }
 
 // ManagerItem 管理器项目接口
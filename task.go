@@ -12,6 +12,7 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -42,6 +43,7 @@ const (
 	TASK_STATE_GOING
 	TASK_STATE_DISPOSING
 	TASK_STATE_DISPOSED
+	TASK_STATE_PAUSED // 追加在末尾以保持已有状态的取值不变
 )
 
 const (
@@ -62,6 +64,7 @@ type (
 		GetTaskID() uint32
 		GetSignal() any
 		Stop(error)
+		Restart(error) *util.Future[struct{}]
 		StopReason() error
 		start() bool
 		dispose()
@@ -73,12 +76,15 @@ type (
 		GetDescriptions() map[string]string
 		SetDescription(key string, value any)
 		SetDescriptions(value Description)
-		SetRetry(maxRetry int, retryInterval time.Duration)
+		SetRetry(maxRetry int, retryInterval time.Duration, policy ...RetryPolicy)
 		Using(resource ...any)
 		OnStop(any)
 		OnStart(func())
 		OnDispose(func())
 		GetState() TaskState
+		Pause() bool
+		Resume() bool
+		IsPaused() bool
 		GetLevel() byte
 		WaitStopped() error
 		WaitStarted() error
@@ -105,6 +111,11 @@ type (
 	TaskDisposal interface {
 		Dispose()
 	}
+	// Pausable 任务暂停和恢复时调用的钩子
+	Pausable interface {
+		OnPause()
+		OnResume()
+	}
 	TaskBlock interface {
 		Run() error
 	}
@@ -114,8 +125,12 @@ type (
 	RetryConfig struct {
 		MaxRetry         int
 		RetryCount       int
-		RetryInterval    time.Duration // Base interval for exponential backoff
-		MaxRetryInterval time.Duration // Maximum interval (0 means no limit)
+		RetryInterval    time.Duration    // Base interval for exponential backoff
+		MaxRetryInterval time.Duration    // Maximum interval (0 means no limit)
+		Policy           RetryPolicy      // Backoff policy (nil means ExponentialBackoff)
+		Retryable        func(error) bool // Classifies stop reasons, false means permanent (nil means all retryable)
+		CircuitBreaker   *CircuitBreaker  // Pauses restarts after repeated failures (nil means disabled)
+		lastDelay        time.Duration
 	}
 	Description    = map[string]any
 	TaskContextKey string
@@ -128,15 +143,26 @@ type (
 		context.CancelCauseFunc
 		handler                                    ITask
 		retry                                      RetryConfig
+		timeout                                    TimeoutConfig
+		depends                                    []Dependency
+		dependFail                                 DependFailPolicy
 		afterStartListeners, afterDisposeListeners []func()
 		closeOnStop                                []any
 		resources                                  []any
 		stopOnce                                   sync.Once
 		description                                sync.Map
-		startup, shutdown                          *util.Promise
+		startup, shutdown                          *util.Future[struct{}]
+		removed                                    *util.Future[struct{}] // 父任务的事件循环不再持有该任务
 		parent                                     *Job
+		ancestors                                  []uint32 // 祖先任务 ID，由近及远
 		parentCtx                                  context.Context
 		state                                      TaskState
+		restartRequest                             atomic.Pointer[restartRequest]
+		restartCount                               atomic.Uint32
+		detached                                   atomic.Bool // 计入 Size 但不在父任务 children 中（替换前后）
+		replaces, replacedBy                       ITask
+		paused                                     atomic.Bool // 暂停标记独立于 state，避免与生命周期的状态写入竞争
+		disposeGoroutine                           atomic.Uint64
 		level                                      byte
 	}
 )
@@ -150,7 +176,10 @@ func (*Task) keepalive() bool {
 }
 
 func (task *Task) GetState() TaskState {
-	return task.state
+	if state := task.state; state < TASK_STATE_STARTED || state >= TASK_STATE_DISPOSING || !task.paused.Load() {
+		return state
+	}
+	return TASK_STATE_PAUSED
 }
 
 func (task *Task) GetLevel() byte {
@@ -164,9 +193,22 @@ func (task *Task) GetParent() ITask {
 	return nil
 }
 
-func (task *Task) SetRetry(maxRetry int, retryInterval time.Duration) {
+func (task *Task) SetRetry(maxRetry int, retryInterval time.Duration, policy ...RetryPolicy) {
 	task.retry.MaxRetry = maxRetry
 	task.retry.RetryInterval = retryInterval
+	if len(policy) > 0 {
+		task.retry.Policy = policy[0]
+	}
+}
+
+// SetRetryable sets the predicate that classifies stop reasons as retryable or permanent
+func (task *Task) SetRetryable(retryable func(error) bool) {
+	task.retry.Retryable = retryable
+}
+
+// SetRetryPolicy sets the backoff policy used between retries
+func (task *Task) SetRetryPolicy(policy RetryPolicy) {
+	task.retry.Policy = policy
 }
 
 // SetMaxRetryInterval sets the maximum retry interval for exponential backoff
@@ -210,7 +252,18 @@ func (task *Task) WaitStarted() error {
 	if task.startup == nil {
 		return nil
 	}
-	return task.startup.Await()
+	_, err := task.startup.Wait()
+	return err
+}
+
+// Started returns the future of the current start, it can be combined by util.All, util.Any and util.Race
+func (task *Task) Started() *util.Future[struct{}] {
+	return task.startup
+}
+
+// Stopped returns the future of the current dispose, rejected with the stop reason
+func (task *Task) Stopped() *util.Future[struct{}] {
+	return task.shutdown
 }
 
 func (task *Task) WaitStopped() (err error) {
@@ -218,7 +271,8 @@ func (task *Task) WaitStopped() (err error) {
 	if err != nil {
 		return err
 	}
-	return task.shutdown.Await()
+	_, err = task.shutdown.Wait()
+	return
 }
 
 func (task *Task) Trace(msg string, fields ...any) {
@@ -255,11 +309,10 @@ func (task *Task) Stop(err error) {
 	_, file, line, _ := runtime.Caller(1)
 	task.stopOnce.Do(func() {
 		if task.CancelCauseFunc != nil {
-			msg := "task cancel context"
-			if task.startup != nil && task.startup.IsRejected() {
-				msg = "task start failed"
-			}
-			task.Debug(msg, "caller", fmt.Sprintf("%s:%d", strings.TrimPrefix(file, sourceFilePathPrefix), line), "reason", err, "elapsed", time.Since(task.StartTime), "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType())
+			// 先发布再取消，取消后事件循环可能已经开始销毁
+			task.publish(EVENT_STOPPING, func(event *LifecycleEvent) {
+				event.Cause, event.Caller = err, fmt.Sprintf("%s:%d", strings.TrimPrefix(file, sourceFilePathPrefix), line)
+			})
 			task.CancelCauseFunc(err)
 		}
 		task.stop()
@@ -307,13 +360,41 @@ func (task *Task) GetSignal() any {
 
 func (task *Task) checkRetry(err error) bool {
 	if errors.Is(err, ErrTaskComplete) || errors.Is(err, ErrExit) || errors.Is(err, ErrStopByUser) {
+		task.SetDescription(ErrorClassKey, ErrorClassTerminal)
+		task.SetDescription(NoRetryReasonKey, err.Error())
+		return false
+	}
+	if task.retry.isPermanent(err) {
+		task.SetDescription(ErrorClassKey, ErrorClassPermanent)
+		task.SetDescription(NoRetryReasonKey, "permanent error: "+err.Error())
+		task.Warn("permanent error, no retry", "taskId", task.ID, "reason", err)
 		return false
 	}
+	task.SetDescription(ErrorClassKey, ErrorClassRetryable)
 	if task.parent.IsStopped() {
+		task.SetDescription(NoRetryReasonKey, "parent stopped")
 		return false
 	}
 	if task.retry.MaxRetry < 0 || task.retry.RetryCount < task.retry.MaxRetry {
+		retryDelay, ok := task.retry.policy().NextDelay(&task.retry, task.retry.RetryCount+1, err)
+		if !ok {
+			task.SetDescription(NoRetryReasonKey, "rejected by policy")
+			task.Warn("retry rejected by policy", "taskId", task.ID, "reason", err)
+			return false
+		}
+		if cb := task.retry.CircuitBreaker; cb != nil {
+			var changed bool
+			if retryDelay, changed = cb.onFailure(time.Now(), task.StartTime, retryDelay); changed {
+				task.publishCircuitState()
+			}
+		}
 		task.retry.RetryCount++
+		task.retry.lastDelay = retryDelay
+		metrics().TaskRetried(task.handler)
+		task.publish(EVENT_RETRY_SCHEDULED, func(event *LifecycleEvent) {
+			event.Cause, event.RetryDelay = err, retryDelay
+		})
+		task.RemoveDescription(NoRetryReasonKey)
 		task.SetDescription("retryCount", task.retry.RetryCount)
 		if task.retry.MaxRetry < 0 {
 			task.Warn(fmt.Sprintf("retry %d/∞", task.retry.RetryCount), "taskId", task.ID)
@@ -321,36 +402,25 @@ func (task *Task) checkRetry(err error) bool {
 			task.Warn(fmt.Sprintf("retry %d/%d", task.retry.RetryCount, task.retry.MaxRetry), "taskId", task.ID)
 		}
 
-		// Calculate exponential backoff delay: baseInterval * 2^(retryCount-1)
-		retryDelay := task.retry.RetryInterval
-		if task.retry.RetryCount > 1 {
-			// Calculate 2^(retryCount-1) using bit shift for better performance
-			exponent := task.retry.RetryCount - 1
-			if exponent < 30 { // Avoid overflow for very large retry counts
-				retryDelay = task.retry.RetryInterval * time.Duration(1<<exponent)
-			} else {
-				// For very large retry counts, use maximum allowed duration
-				retryDelay = task.retry.RetryInterval * time.Duration(1<<30)
-			}
-
-			// Apply maximum delay limit if set
-			if task.retry.MaxRetryInterval > 0 && retryDelay > task.retry.MaxRetryInterval {
-				retryDelay = task.retry.MaxRetryInterval
-			}
-		}
-
 		task.SetDescription("retryDelay", retryDelay.String())
-		if delta := time.Since(task.StartTime); delta < retryDelay {
-			time.Sleep(retryDelay - delta)
-		}
 		return true
 	} else {
 		if task.retry.MaxRetry > 0 {
+			task.SetDescription(NoRetryReasonKey, "max retry reached")
 			task.Warn(fmt.Sprintf("max retry %d failed", task.retry.MaxRetry))
 			return false
 		}
 	}
-	return errors.Is(err, ErrRestart)
+	if errors.Is(err, ErrRestart) {
+		return true
+	}
+	task.SetDescription(NoRetryReasonKey, "retry disabled")
+	return false
+}
+
+// retryWait returns the remaining backoff delay after checkRetry approved a retry
+func (task *Task) retryWait() time.Duration {
+	return task.retry.lastDelay - time.Since(task.StartTime)
 }
 
 func (task *Task) start() bool {
@@ -360,65 +430,113 @@ func (task *Task) start() bool {
 			if r := recover(); r != nil {
 				err = errors.New(fmt.Sprint(r))
 				task.Error("panic", "error", err, "stack", string(debug.Stack()))
+				metrics().TaskPanicked(task.handler)
+				metrics().TaskEnded(task.handler, err, time.Since(task.StartTime)) // panic 后不会再经过 dispose
+				task.publishCause(EVENT_PANIC, err)
+				task.endSpan(err)
+				task.Stop(errors.Join(err, ErrPanic)) // 否则 StopReason 为 nil，会以空原因重试或被当作正常结束
 			}
 		}()
 	}
-	for {
-		task.StartTime = time.Now()
-		task.Debug("task start", "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType(), "reason", task.StartReason)
-		task.state = TASK_STATE_STARTING
-		if v, ok := task.handler.(TaskStarter); ok {
+	task.StartTime = time.Now()
+	task.startSpan()
+	if cb := task.retry.CircuitBreaker; cb != nil && cb.onRestart(task.StartTime) {
+		task.publishCircuitState()
+	}
+	task.state = TASK_STATE_STARTING
+	task.publish(EVENT_STARTING, nil)
+	task.startDeadline()
+	if v, ok := task.handler.(TaskStarter); ok {
+		if task.timeout.StartTimeout > 0 {
+			timer := task.startTimer(task.timeout.StartTimeout, ErrStartTimeout)
+			err = v.Start()
+			timer.Stop()
+		} else {
 			err = v.Start()
 		}
-		if err == nil {
-			task.state = TASK_STATE_STARTED
-			task.startup.Fulfill(err)
-			for _, listener := range task.afterStartListeners {
-				if task.IsStopped() {
-					break
-				}
-				listener()
-			}
+	}
+	if err == nil {
+		task.state = TASK_STATE_STARTED
+		metrics().TaskStarted(task.handler)
+		task.publish(EVENT_STARTED, nil)
+		task.startup.Resolve(struct{}{})
+		for _, listener := range task.afterStartListeners {
 			if task.IsStopped() {
-				err = task.StopReason()
-			} else {
-				task.ResetRetryCount()
-				if runHandler, ok := task.handler.(TaskBlock); ok {
-					task.state = TASK_STATE_RUNNING
-					task.Debug("task run", "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType())
-					err = runHandler.Run()
-					if err == nil {
-						err = ErrTaskComplete
-					}
-				}
+				break
 			}
+			listener()
 		}
-		if err == nil {
-			if goHandler, ok := task.handler.(TaskGo); ok {
-				task.state = TASK_STATE_GOING
-				task.Debug("task go", "taskId", task.ID, "taskType", task.GetTaskType(), "ownerType", task.GetOwnerType())
-				go task.run(goHandler.Go)
-			}
-			return true
+		if task.IsStopped() {
+			err = task.StopReason()
 		} else {
-			task.Stop(err)
-			if task.parent != nil {
-				task.parent.onChildDispose(task.handler)
+			task.ResetRetryCount()
+			if cb := task.retry.CircuitBreaker; cb != nil && cb.onSuccess() {
+				task.publishCircuitState()
 			}
-			if task.checkRetry(err) {
-				task.reset()
-			} else {
-				return false
+			if runHandler := task.getRunHandler(); runHandler != nil {
+				task.state = TASK_STATE_RUNNING
+				task.publish(EVENT_RUNNING, nil)
+				err = runHandler()
+				if err == nil {
+					err = ErrTaskComplete
+				}
 			}
 		}
 	}
+	if err == nil {
+		if goHandler := task.getGoHandler(); goHandler != nil {
+			task.state = TASK_STATE_GOING
+			task.publish(EVENT_RUNNING, nil)
+			task.goWithLabels(func() { task.run(goHandler) })
+		}
+		return true
+	}
+	task.Stop(err)
+	if task.parent != nil {
+		task.parent.onChildDispose(task.handler)
+	}
+	return false
+}
+
+func (task *Task) getRunHandler() func() error {
+	if runHandler, ok := task.handler.(TaskBlock); ok {
+		return runHandler.Run
+	}
+	if resultHandler, ok := task.handler.(taskResult); ok {
+		return resultHandler.resultRun()
+	}
+	return nil
+}
+
+func (task *Task) getGoHandler() func() error {
+	if goHandler, ok := task.handler.(TaskGo); ok {
+		return goHandler.Go
+	}
+	if resultHandler, ok := task.handler.(taskResult); ok {
+		return resultHandler.resultGo()
+	}
+	return nil
+}
+
+// terminate is called once the task will not be started again
+func (task *Task) terminate(err error) {
+	if resultHandler, ok := task.handler.(taskResult); ok {
+		resultHandler.finish(err)
+	}
+	// 未经 dispose 就结束的任务（启动失败、被拒绝添加等）也要唤醒等待销毁的父任务
+	task.shutdown.Reject(err)
+	task.removed.Complete(struct{}{}, err)
+	task.abandonRestart(err)
 }
 
 func (task *Task) reset() {
 	task.stopOnce = sync.Once{}
+	task.paused.Store(false)
 	task.Context, task.CancelCauseFunc = context.WithCancelCause(task.parentCtx)
-	task.shutdown = util.NewPromise(context.Background())
-	task.startup = util.NewPromise(task.Context)
+	task.Context = withTrace(task.Context)
+	task.shutdown = util.NewFuture[struct{}]()
+	task.removed = util.NewFuture[struct{}]()
+	task.startup = util.NewFutureWithContext[struct{}](task.Context)
 }
 
 func (task *Task) GetDescriptions() map[string]string {
@@ -435,15 +553,18 @@ func (task *Task) GetDescription(key string) (any, bool) {
 
 func (task *Task) SetDescription(key string, value any) {
 	task.description.Store(key, value)
+	task.publishDescription(key, value)
 }
 
 func (task *Task) RemoveDescription(key string) {
 	task.description.Delete(key)
+	task.publishDescription(key, nil)
 }
 
 func (task *Task) SetDescriptions(value Description) {
 	for k, v := range value {
 		task.description.Store(k, v)
+		task.publishDescription(k, v)
 	}
 }
 
@@ -451,13 +572,19 @@ func (task *Task) dispose() {
 	taskType, ownerType := task.handler.GetTaskType(), task.GetOwnerType()
 	if task.state < TASK_STATE_STARTED {
 		task.Debug("task dispose canceled", "taskId", task.ID, "taskType", taskType, "ownerType", ownerType, "state", task.state)
+		if task.state == TASK_STATE_STARTING { // 启动失败
+			metrics().TaskEnded(task.handler, task.StopReason(), time.Since(task.StartTime))
+			task.publishCause(EVENT_DISPOSED, task.StopReason())
+			task.endSpan(task.StopReason())
+		}
 		return
 	}
 	reason := task.StopReason()
+	disposeTime := time.Now()
+	metrics().TaskEnded(task.handler, reason, disposeTime.Sub(task.StartTime))
 	task.state = TASK_STATE_DISPOSING
-	yargs := []any{"reason", reason, "taskId", task.ID, "taskType", taskType, "ownerType", ownerType}
-	task.Debug("task dispose", yargs...)
-	defer task.Debug("task disposed", yargs...)
+	task.publishCause(EVENT_DISPOSING, reason)
+	task.disposeGoroutine.Store(goroutineID())
 	if job, ok := task.handler.(IJob); ok {
 		mt := job.getJob()
 		task.SetDescription("disposeProcess", "wait children")
@@ -486,13 +613,18 @@ func (task *Task) dispose() {
 		task.SetDescription("disposeProcess", fmt.Sprintf("a:%d/%d", i, len(task.afterDisposeListeners)))
 		listener()
 	}
+	task.RemoveDescription(TimeRemainingKey)
 	task.SetDescription("disposeProcess", "done")
 	task.state = TASK_STATE_DISPOSED
-	task.shutdown.Fulfill(reason)
+	metrics().TaskDisposed(task.handler, time.Since(disposeTime))
+	task.publishCause(EVENT_DISPOSED, reason)
+	task.endSpan(reason)
+	task.shutdown.Complete(struct{}{}, reason)
 }
 
 func (task *Task) ResetRetryCount() {
 	task.retry.RetryCount = 0
+	task.retry.lastDelay = 0
 }
 
 func (task *Task) GetRetryCount() int {
@@ -510,6 +642,8 @@ func (task *Task) run(handler func() error) {
 			if r := recover(); r != nil {
 				err = errors.New(fmt.Sprint(r))
 				task.Error("panic", "error", err, "stack", string(debug.Stack()))
+				metrics().TaskPanicked(task.handler)
+				task.publishCause(EVENT_PANIC, err)
 			}
 		}
 		if err == nil {
@@ -567,14 +701,27 @@ func (task *Task) RunTask(t ITask, opt ...any) (err error) {
 	mt.initContext(tt, opt...)
 	if mt.IsStopped() {
 		err = mt.StopReason()
-		task.startup.Reject(err)
+		tt.startup.Reject(err)
+		tt.terminate(err)
 		return
 	}
 	task.OnStop(t)
-	started := tt.start()
-	<-tt.Done()
-	if started {
-		tt.dispose()
+	for {
+		started := tt.start()
+		for !started && tt.checkRetry(tt.StopReason()) {
+			time.Sleep(tt.retryWait())
+			tt.reset()
+			started = tt.start()
+		}
+		<-tt.Done()
+		if started {
+			tt.dispose()
+		}
+		if !tt.restarted() {
+			break
+		}
 	}
-	return tt.StopReason()
+	err = tt.StopReason()
+	tt.terminate(err)
+	return
 }
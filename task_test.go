@@ -3,10 +3,19 @@ package task
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http/httptest"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/langhuihui/gotask/util"
 )
 
 // Use RootManager as root task manager
@@ -51,6 +60,95 @@ func Test_RetryTask(t *testing.T) {
 	}
 }
 
+func Test_RetryPolicy(t *testing.T) {
+	config := RetryConfig{RetryInterval: time.Second, MaxRetryInterval: 5 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if delay, _ := (ExponentialBackoff{}).NextDelay(&config, attempt+1, nil); delay != expected {
+			t.Errorf("exponential attempt %d: expected %v, got %v", attempt+1, expected, delay)
+		}
+	}
+	if delay, _ := (LinearBackoff{}).NextDelay(&config, 3, nil); delay != 3*time.Second {
+		t.Errorf("linear: expected 3s, got %v", delay)
+	}
+	if delay, _ := (FullJitterBackoff{}).NextDelay(&config, 3, nil); delay < 0 || delay >= 4*time.Second {
+		t.Errorf("full jitter: delay %v out of range", delay)
+	}
+	var demoTask retryDemoTask
+	var parent Job
+	root.AddTask(&parent)
+	demoTask.SetRetry(3, time.Millisecond, RetryPolicyFunc(func(_ *RetryConfig, attempt int, err error) (time.Duration, bool) {
+		return time.Millisecond, attempt < 2 && errors.Is(err, io.ErrClosedPipe)
+	}))
+	parent.AddTask(&demoTask)
+	_ = parent.WaitStopped()
+	if demoTask.retry.RetryCount != 1 {
+		t.Errorf("expected 1 retry, got %d", demoTask.retry.RetryCount)
+	}
+}
+
+type permanentFailTask struct {
+	Task
+}
+
+func (task *permanentFailTask) Start() error {
+	return Permanent(io.ErrClosedPipe)
+}
+
+func Test_PermanentError(t *testing.T) {
+	var demoTask permanentFailTask
+	var parent Job
+	root.AddTask(&parent)
+	demoTask.SetRetry(3, time.Millisecond)
+	parent.AddTask(&demoTask)
+	_ = parent.WaitStopped()
+	if demoTask.retry.RetryCount != 0 {
+		t.Errorf("expected no retry, got %d", demoTask.retry.RetryCount)
+	}
+	if class, _ := demoTask.GetDescription(ErrorClassKey); class != ErrorClassPermanent {
+		t.Errorf("expected permanent error class, got %v", class)
+	}
+	var classified retryDemoTask
+	var classifiedParent Job
+	root.AddTask(&classifiedParent)
+	classified.SetRetry(3, time.Millisecond)
+	classified.SetRetryable(func(err error) bool {
+		return !errors.Is(err, io.ErrClosedPipe)
+	})
+	classifiedParent.AddTask(&classified)
+	_ = classifiedParent.WaitStopped()
+	if classified.retry.RetryCount != 0 {
+		t.Errorf("expected no retry, got %d", classified.retry.RetryCount)
+	}
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	var demoTask retryDemoTask
+	var parent Job
+	root.AddTask(&parent)
+	var states []CircuitState
+	parent.OnCircuitStateChange(func(child ITask, state CircuitState) {
+		states = append(states, state)
+	})
+	demoTask.SetRetry(3, time.Millisecond)
+	demoTask.SetCircuitBreaker(&CircuitBreaker{FailureThreshold: 2, Window: time.Second, CoolDown: 100 * time.Millisecond})
+	start := time.Now()
+	parent.AddTask(&demoTask)
+	_ = parent.WaitStopped()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected restarts to pause for cool-down, took %v", elapsed)
+	}
+	expected := []CircuitState{CIRCUIT_STATE_OPEN, CIRCUIT_STATE_HALF_OPEN, CIRCUIT_STATE_OPEN, CIRCUIT_STATE_HALF_OPEN}
+	if len(states) != len(expected) {
+		t.Fatalf("expected states %v, got %v", expected, states)
+	}
+	for i, state := range expected {
+		if states[i] != state {
+			t.Errorf("expected states %v, got %v", expected, states)
+			break
+		}
+	}
+}
+
 func Test_Call_ExecutesCallback(t *testing.T) {
 	called := false
 	root.Call(func() {
@@ -220,3 +318,1031 @@ func Test_Block(t *testing.T) {
 //	fmt.Println("Hello World")
 //	return nil
 //}
+
+func Test_CallWithResult(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	var child Task
+	job.AddTask(&child).WaitStarted()
+	value, err := CallWithResult(context.Background(), &job, func() (int32, error) {
+		return job.Size.Load(), nil
+	})
+	if err != nil || value != 1 {
+		t.Errorf("expected 1, got %d %v", value, err)
+	}
+	if _, err = CallWithResult(context.Background(), &job, func() (int, error) {
+		return 0, io.EOF
+	}); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if _, err = CallAsync(ctx, &job, func() (bool, error) {
+		called = true
+		return true, nil
+	}).Await(context.Background()); !errors.Is(err, context.Canceled) || called {
+		t.Errorf("expected canceled call to be skipped, got %v", err)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
+
+func Test_CallAsyncWithoutChildren(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	job.WaitStarted()
+	caller := goroutineID()
+	callee, err := CallWithResult(context.Background(), &job, func() (uint64, error) {
+		return goroutineID(), nil
+	})
+	if err != nil || callee == caller {
+		t.Errorf("expected callback to run on the event loop goroutine, got %d from caller %d, %v", callee, caller, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if job.IsStopped() {
+		t.Errorf("expected a call on a job without children to leave it running, got %v", job.StopReason())
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
+
+func Test_FutureCombinators(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	var tasks [3]Task
+	futures := make([]*util.Future[struct{}], len(tasks))
+	for i := range tasks {
+		futures[i] = job.AddTask(&tasks[i]).Started()
+	}
+	if _, err := util.All(futures...).Await(context.Background()); err != nil {
+		t.Errorf("expected all started, got %v", err)
+	}
+	doubled, err := util.Then(util.Race(util.NewFuture[int](), func() *util.Future[int] {
+		f := util.NewFuture[int]()
+		f.Resolve(21)
+		return f
+	}()), func(v int) (int, error) {
+		return v * 2, nil
+	}).Wait()
+	if err != nil || doubled != 42 {
+		t.Errorf("expected 42, got %d %v", doubled, err)
+	}
+	rejected := util.NewFuture[int]()
+	rejected.Reject(io.EOF)
+	if _, err = util.Any(rejected).Wait(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	tasks[0].Stop(ErrTaskComplete)
+	if _, err = tasks[0].Stopped().Wait(); !errors.Is(err, ErrTaskComplete) {
+		t.Errorf("expected ErrTaskComplete, got %v", err)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
+
+type sumTask struct {
+	ResultTask[int]
+	values []int
+}
+
+func (task *sumTask) Run() (sum int, err error) {
+	for _, v := range task.values {
+		sum += v
+	}
+	return
+}
+
+type resultFailTask struct {
+	ResultTask[string]
+}
+
+func (task *resultFailTask) Go() (string, error) {
+	return "", io.ErrUnexpectedEOF
+}
+
+func Test_ResultTask(t *testing.T) {
+	sum := sumTask{values: []int{1, 2, 3}}
+	root.AddTask(&sum)
+	if value, err := sum.WaitResult(); err != nil || value != 6 {
+		t.Errorf("expected 6, got %d %v", value, err)
+	}
+	var failed resultFailTask
+	root.AddTask(&failed)
+	if _, err := failed.WaitResult(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	var job Job
+	root.AddTask(&job)
+	value, err := RunTaskWithResult[int](&job, &sumTask{values: []int{4, 5}})
+	if err != nil || value != 9 {
+		t.Errorf("expected 9, got %d %v", value, err)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
+
+type slowStartTask struct {
+	Task
+}
+
+func (task *slowStartTask) Start() error {
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+type waitDoneTask struct {
+	Task
+}
+
+func (task *waitDoneTask) Go() error {
+	<-task.Done()
+	return nil
+}
+
+func Test_Timeout(t *testing.T) {
+	var slow slowStartTask
+	slow.SetStartTimeout(50 * time.Millisecond)
+	if err := root.AddTask(&slow).WaitStarted(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected start timeout, got %v", err)
+	}
+	var waiting waitDoneTask
+	root.AddTask(&waiting, TimeoutConfig{Timeout: 100 * time.Millisecond})
+	if err := waiting.WaitStarted(); err != nil {
+		t.Fatalf("expected task started, got %v", err)
+	}
+	if _, ok := waiting.GetDescriptions()[TimeRemainingKey]; !ok {
+		t.Errorf("expected remaining time in descriptions")
+	}
+	if err := waiting.WaitStopped(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+}
+
+type stuckDisposeTask struct {
+	Task
+	release chan struct{}
+}
+
+func (task *stuckDisposeTask) Dispose() {
+	<-task.release
+}
+
+func Test_DisposeTimeout(t *testing.T) {
+	var job Job
+	job.SetDisposeTimeout(50*time.Millisecond, true)
+	root.AddTask(&job)
+	stuck := stuckDisposeTask{release: make(chan struct{})}
+	defer close(stuck.release)
+	job.AddTask(&stuck).WaitStarted()
+	job.WaitStarted()
+	start := time.Now()
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected job to proceed after dispose timeout, took %v", elapsed)
+	}
+	if leaked := job.LeakedChildren(); len(leaked) != 1 || leaked[0] != ITask(&stuck) {
+		t.Errorf("expected stuck child to be recorded as leaked, got %v", leaked)
+	}
+}
+
+type orderedDisposeTask struct {
+	Task
+	name  string
+	delay time.Duration
+	mux   *sync.Mutex
+	order *[]string
+}
+
+func (task *orderedDisposeTask) Dispose() {
+	time.Sleep(100*time.Millisecond + task.delay)
+	task.mux.Lock()
+	*task.order = append(*task.order, task.name)
+	task.mux.Unlock()
+}
+
+func Test_DisposeOrder(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	var mux sync.Mutex
+	var order []string
+	db := orderedDisposeTask{name: "db", mux: &mux, order: &order}
+	api := orderedDisposeTask{name: "api", mux: &mux, order: &order}
+	cache := orderedDisposeTask{name: "cache", mux: &mux, order: &order}
+	disposed := 0 // OnDescendantsDispose 在事件循环中调用，无需加锁
+	job.OnDescendantsDispose(func(ITask) {
+		disposed++
+	})
+	job.AddTask(&db).WaitStarted()
+	api.Using(&db)
+	job.AddTask(&api).WaitStarted()
+	job.AddTask(&cache).WaitStarted()
+	job.WaitStarted()
+	start := time.Now()
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("expected independent children to dispose concurrently, took %v", elapsed)
+	}
+	if len(order) != 3 || order[len(order)-1] != "db" {
+		t.Errorf("expected db to dispose after api, got %v", order)
+	}
+	if disposed != 3 {
+		t.Errorf("expected 3 dispose notifications, got %d", disposed)
+	}
+}
+
+type orderedDisposeJob struct {
+	Job
+	mux   sync.Mutex
+	order []string
+	api   atomic.Pointer[orderedDisposeTask]
+}
+
+func (job *orderedDisposeJob) Start() error {
+	db := &orderedDisposeTask{name: "db", mux: &job.mux, order: &job.order}
+	api := &orderedDisposeTask{name: "api", delay: 50 * time.Millisecond, mux: &job.mux, order: &job.order}
+	api.Using(db)
+	job.AddTask(db)
+	job.AddTask(api)
+	job.api.Store(api)
+	return nil
+}
+
+func Test_DisposeOrderAfterRetry(t *testing.T) {
+	var job orderedDisposeJob
+	job.SetRetry(1, time.Millisecond)
+	root.AddTask(&job)
+	job.WaitStarted()
+	first := job.api.Load()
+	first.WaitStarted()
+	job.Stop(io.EOF)
+	for api := job.api.Load(); api == first || api.WaitStarted() != nil; api = job.api.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+	time.Sleep(200 * time.Millisecond)
+	job.mux.Lock()
+	defer job.mux.Unlock()
+	expected := []string{"api", "db", "api", "db"}
+	if len(job.order) != len(expected) {
+		t.Fatalf("expected dispose order %v, got %v", expected, job.order)
+	}
+	for i, name := range expected {
+		if job.order[i] != name {
+			t.Errorf("expected dispose order %v on every run, got %v", expected, job.order)
+			break
+		}
+	}
+}
+
+func Test_Dependency(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	first := sumTask{values: []int{1}}
+	second := sumTask{values: []int{2}}
+	var failed startFailTask
+	var dependent, stranger Task
+	ignored := sumTask{values: []int{3}}
+	job.AddTask(&first)
+	job.AddTask(&second, AfterSuccess(&first))
+	job.AddTask(&failed)
+	job.AddTask(&dependent, AfterSuccess(&failed))
+	job.AddTask(&ignored, After(&failed), DEPEND_FAIL_IGNORE)
+	if err := job.AddTask(&stranger, After(&job)).WaitStarted(); !errors.Is(err, ErrDependency) {
+		t.Errorf("expected ErrDependency for non-sibling, got %v", err)
+	}
+	if value, err := second.WaitResult(); err != nil || value != 2 {
+		t.Errorf("expected 2, got %d %v", value, err)
+	}
+	if !first.IsStopped() {
+		t.Errorf("expected second to start after first completed")
+	}
+	if depends, _ := second.GetDescription(DependsOnKey); len(depends.([]string)) != 1 {
+		t.Errorf("expected dependsOn description, got %v", depends)
+	}
+	if err := dependent.WaitStarted(); !errors.Is(err, ErrDependency) {
+		t.Errorf("expected ErrDependency, got %v", err)
+	}
+	if value, err := ignored.WaitResult(); err != nil || value != 3 {
+		t.Errorf("expected ignored dependency to start, got %d %v", value, err)
+	}
+	job.WaitStopped()
+}
+
+type keyedTask struct {
+	Task
+	key string
+}
+
+func (task *keyedTask) GetKey() string {
+	return task.key
+}
+
+func Test_DependencyRejected(t *testing.T) {
+	var job Job
+	root.AddTask(&job)
+	first, duplicate := keyedTask{key: "dup"}, keyedTask{key: "dup"}
+	var dependent Task
+	job.AddTask(&first).WaitStarted()
+	if err := job.AddTask(&duplicate).WaitStarted(); !errors.As(err, &ExistTaskError{}) {
+		t.Fatalf("expected ExistTaskError, got %v", err)
+	}
+	job.AddTask(&dependent, After(&duplicate))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := dependent.Started().Await(ctx); !errors.Is(err, ErrDependency) {
+		t.Errorf("expected ErrDependency for a rejected prerequisite, got %v", err)
+	}
+	job.Stop(ErrTaskComplete)
+	job.WaitStopped()
+}
+
+func Test_CronSchedule(t *testing.T) {
+	zone := time.FixedZone("UTC+8", 8*3600)
+	cases := []struct {
+		spec     string
+		from, to time.Time
+	}{
+		{"0 3 * * *", time.Date(2024, 1, 1, 5, 0, 0, 0, zone), time.Date(2024, 1, 2, 3, 0, 0, 0, zone)},
+		{"*/15 9-17 * * mon-fri", time.Date(2024, 6, 1, 10, 0, 0, 0, zone), time.Date(2024, 6, 3, 9, 0, 0, 0, zone)},
+		{"0 0 29 2 *", time.Date(2023, 3, 1, 0, 0, 0, 0, zone), time.Date(2024, 2, 29, 0, 0, 0, 0, zone)},
+		{"0 0 1 * 1", time.Date(2024, 6, 1, 0, 0, 0, 0, zone), time.Date(2024, 6, 3, 0, 0, 0, 0, zone)},
+		{"30 */10 * * * *", time.Date(2024, 6, 1, 0, 0, 30, 0, zone), time.Date(2024, 6, 1, 0, 10, 30, 0, zone)},
+		{"@daily", time.Date(2024, 12, 31, 1, 0, 0, 0, zone), time.Date(2025, 1, 1, 0, 0, 0, 0, zone)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.spec, err)
+		}
+		schedule.Location = zone
+		if next := schedule.Next(c.from); !next.Equal(c.to) {
+			t.Errorf("%q after %v: expected %v, got %v", c.spec, c.from, c.to, next)
+		}
+	}
+	for _, spec := range []string{"61 * * * *", "* * *", "5-1 * * * *", "@every -1s"} {
+		if _, err := ParseCron(spec); !errors.Is(err, ErrCronSpec) {
+			t.Errorf("expected ErrCronSpec for %q, got %v", spec, err)
+		}
+	}
+}
+
+type countCronTask struct {
+	CronTask
+	runs atomic.Int32
+}
+
+func (task *countCronTask) Tick(any) {
+	task.runs.Add(1)
+}
+
+func Test_CronMissedPolicy(t *testing.T) {
+	for policy, expected := range map[CronMissedPolicy]int32{CRON_MISSED_SKIP: 0, CRON_MISSED_RUN_ONCE: 1, CRON_MISSED_CATCH_UP: 5} {
+		task := countCronTask{CronTask: CronTask{Spec: "@every 50ms", Missed: policy, Grace: 5 * time.Millisecond}}
+		task.SetLastRun(time.Now().Add(-265 * time.Millisecond))
+		root.AddTask(&task).WaitStarted()
+		time.Sleep(10 * time.Millisecond)
+		if runs := task.runs.Load(); runs != expected {
+			t.Errorf("%s: expected %d missed runs to execute, got %d", policy, expected, runs)
+		}
+		if _, ok := task.GetDescription(NextRunKey); !ok {
+			t.Errorf("%s: expected nextRun description", policy)
+		}
+		task.Stop(ErrTaskComplete)
+		task.WaitStopped()
+	}
+}
+
+type countTickTask struct {
+	TickTask
+	ticks atomic.Int32
+}
+
+func (task *countTickTask) GetTickInterval() time.Duration {
+	return time.Hour
+}
+
+func (task *countTickTask) Tick(any) {
+	task.ticks.Add(1)
+}
+
+func Test_TickIntervalPause(t *testing.T) {
+	var task countTickTask
+	root.AddTask(&task).WaitStarted()
+	defer task.Stop(ErrTaskComplete)
+	task.SetTickInterval(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if task.ticks.Load() == 0 {
+		t.Fatalf("expected new interval to take effect on the live ticker")
+	}
+	if !task.Pause() || task.Pause() {
+		t.Errorf("expected only the first Pause to take effect")
+	}
+	time.Sleep(20 * time.Millisecond)
+	paused := task.ticks.Load()
+	time.Sleep(50 * time.Millisecond)
+	if ticks := task.ticks.Load(); ticks != paused || !task.IsPaused() {
+		t.Errorf("expected no ticks while paused, got %d then %d", paused, ticks)
+	}
+	if v, ok := task.GetDescription(PausedKey); !ok || v != true {
+		t.Errorf("expected paused description")
+	}
+	if state := task.GetState(); state != TASK_STATE_PAUSED {
+		t.Errorf("expected paused state, got %d", state)
+	}
+	if !task.Resume() {
+		t.Errorf("expected Resume to take effect")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if task.ticks.Load() == paused {
+		t.Errorf("expected ticks after resume")
+	}
+}
+
+func Test_TickIntervalReset(t *testing.T) {
+	var task countTickTask
+	root.AddTask(&task).WaitStarted()
+	defer task.Stop(ErrTaskComplete)
+	task.SetTickInterval(10 * time.Millisecond)
+	task.SetTickInterval(-time.Second)
+	task.SetTickInterval(0)
+	if v, _ := task.GetDescription(TickIntervalKey); v != time.Hour.String() {
+		t.Errorf("expected interval 0 to restore GetTickInterval, got %v", v)
+	}
+	ticks := task.ticks.Load()
+	time.Sleep(50 * time.Millisecond)
+	if task.ticks.Load() != ticks || task.IsStopped() {
+		t.Errorf("expected the ticker to fall back to GetTickInterval")
+	}
+}
+
+type slowAsyncTickTask struct {
+	AsyncTickTask
+	active, peak atomic.Int32
+}
+
+func (task *slowAsyncTickTask) GetTickInterval() time.Duration {
+	return 10 * time.Millisecond
+}
+
+func (task *slowAsyncTickTask) Tick(any) {
+	active := task.active.Add(1)
+	for peak := task.peak.Load(); active > peak && !task.peak.CompareAndSwap(peak, active); peak = task.peak.Load() {
+	}
+	time.Sleep(35 * time.Millisecond)
+	task.active.Add(-1)
+}
+
+func Test_TickOverlapPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy  TickOverlapPolicy
+		max     int32
+		delayed bool
+	}{{TICK_OVERLAP_SKIP, 1, false}, {TICK_OVERLAP_QUEUE_ONE, 1, true}, {TICK_OVERLAP_CONCURRENT, 2, false}} {
+		var task slowAsyncTickTask
+		task.SetOverlapPolicy(c.policy, 2)
+		histogram := task.TickDuration()
+		root.AddTask(&task).WaitStarted()
+		time.Sleep(200 * time.Millisecond)
+		task.Stop(ErrTaskComplete)
+		task.WaitStopped()
+		if peak := task.peak.Load(); peak != c.max {
+			t.Errorf("%s: expected %d concurrent ticks, got %d", c.policy, c.max, peak)
+		}
+		if task.SkippedTicks() == 0 || (task.DelayedTicks() > 0) != c.delayed {
+			t.Errorf("%s: unexpected skipped %d delayed %d", c.policy, task.SkippedTicks(), task.DelayedTicks())
+		}
+		if task.TickDuration() != histogram || histogram.Count() == 0 {
+			t.Errorf("%s: expected tick durations in the histogram created before start", c.policy)
+		}
+	}
+}
+
+type pausableTask struct {
+	Task
+	pauses, resumes atomic.Int32
+}
+
+func (task *pausableTask) OnPause() {
+	task.pauses.Add(1)
+}
+
+func (task *pausableTask) OnResume() {
+	task.resumes.Add(1)
+}
+
+func Test_PauseSubtree(t *testing.T) {
+	var job Job
+	var ticker countTickTask
+	var hooked, late pausableTask
+	root.AddTask(&job)
+	job.AddTask(&ticker).WaitStarted()
+	defer job.Stop(ErrTaskComplete)
+	job.AddTask(&hooked).WaitStarted()
+	ticker.SetTickInterval(5 * time.Millisecond)
+	if !job.Pause() || job.Pause() {
+		t.Fatalf("expected only the first Pause to take effect")
+	}
+	if !ticker.IsPaused() || !hooked.IsPaused() || hooked.pauses.Load() != 1 {
+		t.Errorf("expected pause to cascade to children")
+	}
+	job.AddTask(&late).WaitStarted()
+	if !late.IsPaused() {
+		t.Errorf("expected child added to a paused job to start paused")
+	}
+	time.Sleep(20 * time.Millisecond)
+	ticks := ticker.ticks.Load()
+	time.Sleep(30 * time.Millisecond)
+	if ticker.ticks.Load() != ticks {
+		t.Errorf("expected no ticks dispatched while paused")
+	}
+	if !job.Resume() || job.IsPaused() || hooked.IsPaused() || hooked.resumes.Load() != 1 || late.GetState() != TASK_STATE_STARTED {
+		t.Errorf("expected resume to cascade to children")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ticker.ticks.Load() == ticks {
+		t.Errorf("expected ticks after resume")
+	}
+}
+
+func Test_PauseAfterStarted(t *testing.T) {
+	var task waitDoneTask
+	root.AddTask(&task).WaitStarted()
+	defer task.Stop(ErrTaskComplete)
+	if !task.Pause() {
+		t.Fatalf("expected Pause right after start to take effect")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !task.IsPaused() {
+		t.Errorf("expected pause to survive the switch to GOING")
+	}
+	if !task.Resume() || task.IsPaused() {
+		t.Errorf("expected Resume to take effect")
+	}
+}
+
+type sleepRunTask struct {
+	Task
+}
+
+func (task *sleepRunTask) Run() error {
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func Test_Drain(t *testing.T) {
+	var work Work
+	var quick sleepRunTask
+	root.AddTask(&work)
+	work.AddTask(&quick).WaitStarted()
+	done := make(chan error, 1)
+	go func() {
+		done <- work.Drain(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if !work.IsDraining() {
+		t.Errorf("expected work to be draining")
+	}
+	if err := work.AddTask(&Task{}).WaitStarted(); !errors.Is(err, ErrDraining) {
+		t.Errorf("expected ErrDraining, got %v", err)
+	}
+	if quick.IsStopped() {
+		t.Errorf("expected existing child to keep running while draining")
+	}
+	if err := <-done; err != nil || !errors.Is(work.StopReason(), ErrDrained) || !quick.StopReasonIs(ErrTaskComplete) {
+		t.Errorf("expected graceful drain, got %v %v", err, work.StopReason())
+	}
+	var job Job
+	var last sleepRunTask
+	root.AddTask(&job)
+	job.AddTask(&last).WaitStarted()
+	if err := job.Drain(context.Background()); err != nil || !errors.Is(job.StopReason(), ErrDrained) {
+		t.Errorf("expected plain job to drain without auto stop, got %v %v", err, job.StopReason())
+	}
+	var stuck Work
+	var child waitDoneTask
+	root.AddTask(&stuck)
+	stuck.AddTask(&child).WaitStarted()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := stuck.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) || !child.IsStopped() || !errors.Is(stuck.StopReason(), ErrDraining) {
+		t.Errorf("expected drain deadline to force stop children, got %v %v", err, stuck.StopReason())
+	}
+}
+
+type restartCountTask struct {
+	Task
+	starts atomic.Int32
+}
+
+func (task *restartCountTask) Start() error {
+	task.starts.Add(1)
+	return nil
+}
+
+func Test_Restart(t *testing.T) {
+	var task restartCountTask
+	task.SetRetry(1, time.Millisecond)
+	root.AddTask(&task).WaitStarted()
+	id := task.GetTaskID()
+	for i := range 3 {
+		started := task.Restart(io.EOF)
+		if started == nil {
+			t.Fatalf("restart %d rejected", i)
+		}
+		if _, err := started.Wait(); err != nil {
+			t.Fatalf("restart %d failed to start: %v", i, err)
+		}
+	}
+	if task.starts.Load() != 4 || task.RestartCount() != 3 || task.GetTaskID() != id {
+		t.Errorf("expected 3 restarts under the same ID, got starts %d restarts %d", task.starts.Load(), task.RestartCount())
+	}
+	if reason, _ := task.GetDescription(RestartReasonKey); reason != io.EOF.Error() {
+		t.Errorf("expected restart reason description, got %v", reason)
+	}
+	task.Stop(ErrTaskComplete)
+	task.WaitStopped()
+	if task.retry.RetryCount != 0 {
+		t.Errorf("expected restart not to consume retries, got %d", task.retry.RetryCount)
+	}
+	if task.Restart(nil) != nil {
+		t.Errorf("expected restart of a stopped task to be rejected")
+	}
+}
+
+type configItem struct {
+	Task
+	key     string
+	version int
+	fail    bool
+	hold    chan struct{}
+	log     *[]string
+}
+
+func (item *configItem) GetKey() string {
+	return item.key
+}
+
+func (item *configItem) Start() error {
+	if item.fail {
+		return io.ErrUnexpectedEOF
+	}
+	*item.log = append(*item.log, fmt.Sprintf("start %d", item.version))
+	return nil
+}
+
+func (item *configItem) Dispose() {
+	if item.hold != nil {
+		<-item.hold
+	}
+	*item.log = append(*item.log, fmt.Sprintf("dispose %d", item.version))
+}
+
+func Test_WorkCollectionReplace(t *testing.T) {
+	var collection WorkCollection[string, *configItem]
+	root.AddTask(&collection)
+	defer collection.Stop(ErrTaskComplete)
+	var log []string
+	v1 := &configItem{key: "a", version: 1, log: &log}
+	v2 := &configItem{key: "a", version: 2, log: &log}
+	v3 := &configItem{key: "a", version: 3, log: &log}
+	broken := &configItem{key: "a", version: 4, fail: true, log: &log}
+	collection.Upsert(v1, REPLACE_START_BEFORE_STOP).WaitStarted()
+	collection.Replace(v2, REPLACE_START_BEFORE_STOP).WaitStarted()
+	if item, _ := collection.Get("a"); item != v2 {
+		t.Errorf("expected key to switch once v2 started")
+	}
+	v1.WaitStopped()
+	if !errors.Is(v1.StopReason(), ErrReplaced) {
+		t.Errorf("expected v1 stopped with ErrReplaced, got %v", v1.StopReason())
+	}
+	collection.Upsert(v3, REPLACE_STOP_BEFORE_START).WaitStarted()
+	if item, _ := collection.Get("a"); item != v3 || collection.Length() != 1 {
+		t.Errorf("expected v3 to be the only item, got %v %d", item, collection.Length())
+	}
+	if err := collection.Replace(broken, REPLACE_START_BEFORE_STOP).WaitStarted(); err == nil {
+		t.Errorf("expected broken replacement to fail")
+	}
+	if err := collection.Replace(&configItem{key: "b", log: &log}, REPLACE_STOP_BEFORE_START).WaitStarted(); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("expected ErrTaskNotFound, got %v", err)
+	}
+	collection.Call(func() {
+		expected := []string{"start 1", "start 2", "dispose 1", "dispose 2", "start 3"}
+		if item, _ := collection.Get("a"); item != v3 || collection.Length() != 1 || !slices.Equal(log, expected) {
+			t.Errorf("expected v3 to survive a failed replacement, got %v %d %v", item, collection.Length(), log)
+		}
+	})
+}
+
+func Test_ReplaceStopBeforeStartTwice(t *testing.T) {
+	var collection WorkCollection[string, *configItem]
+	root.AddTask(&collection)
+	defer collection.Stop(ErrTaskComplete)
+	var log []string
+	v1 := &configItem{key: "a", version: 1, hold: make(chan struct{}), log: &log}
+	v2 := &configItem{key: "a", version: 2, log: &log}
+	v3 := &configItem{key: "a", version: 3, log: &log}
+	collection.Upsert(v1, REPLACE_STOP_BEFORE_START).WaitStarted()
+	collection.Replace(v2, REPLACE_STOP_BEFORE_START)
+	collection.Replace(v3, REPLACE_STOP_BEFORE_START)
+	if err := v2.WaitStarted(); !errors.Is(err, ErrReplaced) {
+		t.Errorf("expected the pending replacement to be rejected with ErrReplaced, got %v", err)
+	}
+	close(v1.hold)
+	if err := v3.WaitStarted(); err != nil {
+		t.Fatalf("expected the latest replacement to start, got %v", err)
+	}
+	collection.Call(func() {
+		expected := []string{"start 1", "dispose 1", "start 3"}
+		if item, _ := collection.Get("a"); item != v3 || collection.Length() != 1 || !slices.Equal(log, expected) {
+			t.Errorf("expected only v3 to take over, got %v %d %v", item, collection.Length(), log)
+		}
+	})
+}
+
+type panicRunTask struct {
+	Task
+}
+
+func (*panicRunTask) Run() error {
+	panic("boom")
+}
+
+type panicStartTask struct {
+	Task
+}
+
+func (*panicStartTask) Start() error {
+	panic("boom")
+}
+
+func Test_StartPanic(t *testing.T) {
+	var task panicStartTask
+	var parent Job
+	root.AddTask(&parent)
+	task.SetRetry(1, time.Millisecond)
+	parent.AddTask(&task)
+	parent.WaitStopped()
+	if err := task.StopReason(); !errors.Is(err, ErrPanic) {
+		t.Errorf("expected panic as stop reason, got %v", err)
+	}
+	if task.retry.RetryCount != 1 {
+		t.Errorf("expected panic to be retried once, got %d", task.retry.RetryCount)
+	}
+}
+
+func Test_Metrics(t *testing.T) {
+	m := NewMemoryMetrics()
+	SetMetricsSink(m)
+	defer SetMetricsSink(DefaultMetrics)
+	var parent Job
+	root.AddTask(&parent, Description{OwnerTypeKey: "metricsJob"})
+	var block Task
+	parent.AddTask(&block, Description{OwnerTypeKey: "metricsBlock"}).WaitStarted()
+	var retry retryDemoTask
+	retry.SetRetry(1, time.Millisecond)
+	parent.AddTask(&retry, Description{OwnerTypeKey: "metricsRetry"})
+	retry.WaitStopped()
+	var panicking panicRunTask
+	parent.AddTask(&panicking, Description{OwnerTypeKey: "metricsPanic"})
+	panicking.WaitStopped()
+	time.Sleep(10 * time.Millisecond)
+	parent.Call(func() {
+		if job, ok := m.Job(parent.GetTaskID()); !ok || job.OwnerType != "metricsJob" || job.Children != 1 {
+			t.Errorf("expected job metrics with 1 child, got %+v %v", job, ok)
+		}
+	})
+	parent.Stop(ErrStopByUser)
+	parent.WaitStopped()
+	block.WaitStopped()
+	time.Sleep(10 * time.Millisecond)
+	if owner := m.Owner("metricsRetry"); owner.Failed != 2 || owner.Retried != 1 || owner.Started != 0 {
+		t.Errorf("expected 2 failures and 1 retry, got %+v", owner)
+	}
+	if owner := m.Owner("metricsPanic"); owner.Panicked != 1 || owner.Failed != 1 || owner.Started != 1 {
+		t.Errorf("expected 1 panic, got %+v", owner)
+	}
+	owner := m.Owner("metricsBlock")
+	if owner.Started != 1 || owner.Completed != 1 || owner.Lifetime.Count() != 1 || owner.Dispose.Count() != 1 {
+		t.Errorf("expected block task to complete once, got %+v", owner)
+	}
+	if _, ok := m.Job(parent.GetTaskID()); ok {
+		t.Errorf("expected job metrics removed after dispose")
+	}
+}
+
+func Test_PrometheusHandler(t *testing.T) {
+	m := NewMemoryMetrics()
+	SetMetricsSink(m)
+	defer SetMetricsSink(DefaultMetrics)
+	var parent Job
+	root.AddTask(&parent, Description{OwnerTypeKey: "prom\"Job"}).WaitStarted()
+	defer parent.Stop(ErrTaskComplete)
+	var child Task
+	parent.AddTask(&child, Description{OwnerTypeKey: "promChild"}).WaitStarted()
+	var failing retryDemoTask
+	parent.AddTask(&failing, Description{OwnerTypeKey: "promFail"})
+	failing.WaitStopped()
+	time.Sleep(10 * time.Millisecond)
+	handler := &PrometheusHandler{Root: &parent, Metrics: m}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Header().Get("Content-Type") != PrometheusContentType {
+		t.Errorf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE gotask_tasks gauge",
+		`gotask_tasks{state="started",owner_type="prom\"Job",level="1"} 1`,
+		`gotask_tasks{state="started",owner_type="promChild",level="2"} 1`,
+		fmt.Sprintf(`gotask_job_children{job_id="%d",owner_type="prom\"Job",level="1"} 1`, parent.GetTaskID()),
+		`gotask_task_failed_total{owner_type="promFail"} 1`,
+		`gotask_task_started_total{owner_type="promChild"} 1`,
+		"# TYPE gotask_task_dispose_duration_seconds histogram",
+		`gotask_task_lifetime_seconds_bucket{owner_type="promFail",le="+Inf"} 1`,
+		`gotask_task_lifetime_seconds_count{owner_type="promFail"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %s in\n%s", line, body)
+		}
+	}
+}
+
+type (
+	recordingTracer struct {
+		sync.Mutex
+		spans []*recordedSpan
+	}
+	recordedSpan struct {
+		tracer *recordingTracer
+		parent Span
+		attrs  map[string]any
+		reason error
+		failed bool
+		ended  int
+	}
+	recordedSpanKey struct{}
+	spanCaptureTask struct {
+		Task
+		own, fromTracer Span
+	}
+)
+
+func (tr *recordingTracer) StartSpan(ctx context.Context, task ITask, parent Span) (context.Context, Span) {
+	tr.Lock()
+	defer tr.Unlock()
+	span := &recordedSpan{tracer: tr, parent: parent, attrs: make(map[string]any)}
+	tr.spans = append(tr.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (tr *recordingTracer) find(ownerType string) *recordedSpan {
+	tr.Lock()
+	defer tr.Unlock()
+	for _, span := range tr.spans {
+		if span.attrs["task.ownerType"] == ownerType {
+			return span
+		}
+	}
+	return nil
+}
+
+func (s *recordedSpan) SetAttribute(key string, value any) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) End(reason error, failed bool) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+	s.reason, s.failed = reason, failed
+	s.ended++
+}
+
+func (task *spanCaptureTask) Start() error {
+	task.own = SpanFromContext(task)
+	task.fromTracer, _ = task.Value(recordedSpanKey{}).(Span)
+	return nil
+}
+
+func Test_Tracing(t *testing.T) {
+	var tracer recordingTracer
+	SetTracer(&tracer)
+	defer SetTracer(nil)
+	var parent Job
+	root.AddTask(&parent, Description{OwnerTypeKey: "traceJob"}).WaitStarted()
+	var child spanCaptureTask
+	parent.AddTask(&child, Description{OwnerTypeKey: "traceChild", "k": "v"}).WaitStarted()
+	var failing startFailTask
+	parent.AddTask(&failing, Description{OwnerTypeKey: "traceFail"})
+	failing.WaitStopped()
+	parent.Stop(ErrStopByUser)
+	parent.WaitStopped()
+	child.WaitStopped()
+	time.Sleep(10 * time.Millisecond)
+	jobSpan, childSpan, failSpan := tracer.find("traceJob"), tracer.find("traceChild"), tracer.find("traceFail")
+	if jobSpan == nil || childSpan == nil || failSpan == nil {
+		t.Fatalf("expected spans for all tasks, got %d", len(tracer.spans))
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+	if childSpan.parent != jobSpan || failSpan.parent != jobSpan {
+		t.Errorf("expected children to link to the job span")
+	}
+	if child.own != childSpan || child.fromTracer != childSpan {
+		t.Errorf("expected span to propagate through the task context")
+	}
+	if childSpan.attrs["k"] != "v" || childSpan.attrs["task.parentId"] != parent.GetTaskID() {
+		t.Errorf("expected descriptions as attributes, got %v", childSpan.attrs)
+	}
+	if childSpan.ended != 1 || childSpan.failed || !errors.Is(childSpan.reason, ErrStopByUser) {
+		t.Errorf("expected child span to end once with ErrStopByUser, got %d %v %v", childSpan.ended, childSpan.failed, childSpan.reason)
+	}
+	if failSpan.ended != 1 || !failSpan.failed {
+		t.Errorf("expected failed start to end its span as failed, got %d %v", failSpan.ended, failSpan.failed)
+	}
+}
+
+type blockGoTask struct {
+	Task
+}
+
+func (task *blockGoTask) Go() error {
+	<-task.Done()
+	return nil
+}
+
+func Test_PprofLabels(t *testing.T) {
+	var parent Job
+	root.AddTask(&parent).WaitStarted()
+	defer parent.Stop(ErrTaskComplete)
+	var task blockGoTask
+	parent.AddTask(&task, Description{OwnerTypeKey: "labeled"}).WaitStarted()
+	labels := make(chan map[string]string, 1)
+	task.GoWithLabels(func(ctx context.Context) {
+		values := make(map[string]string)
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			values[key] = value
+			return true
+		})
+		labels <- values
+	})
+	id, parentID := strconv.Itoa(int(task.GetTaskID())), strconv.Itoa(int(parent.GetTaskID()))
+	if values := <-labels; values[LabelTaskID] != id || values[LabelParentID] != parentID || values[LabelOwnerType] != "labeled" || values[LabelLevel] != "2" {
+		t.Errorf("unexpected labels %v", values)
+	}
+	var profile strings.Builder
+	pprof.Lookup("goroutine").WriteTo(&profile, 1)
+	if !strings.Contains(profile.String(), `"taskId":"`+id+`"`) || !strings.Contains(profile.String(), `"taskId":"`+parentID+`"`) {
+		t.Errorf("expected goroutines of the task and its job event loop to be labeled")
+	}
+}
+
+func Test_LifecycleEvents(t *testing.T) {
+	var parent Job
+	root.AddTask(&parent).WaitStarted()
+	defer parent.Stop(ErrTaskComplete)
+	sub := parent.SubscribeEvents(0, DROP_NEWEST)
+	defer sub.Close()
+	latest := SubscribeEvents(1, DROP_OLDEST, func(event *LifecycleEvent) bool {
+		return event.Type == EVENT_DESCRIPTION_CHANGED && event.Key == "step"
+	})
+	defer latest.Close()
+	var task Task
+	parent.AddTask(&task)
+	task.WaitStarted()
+	for i := range 3 {
+		task.SetDescription("step", i)
+	}
+	task.Stop(ErrStopByUser)
+	task.WaitStopped()
+	var types []LifecycleEventType
+	timeout := time.After(time.Second)
+	for !slices.Contains(types, EVENT_DISPOSED) {
+		select {
+		case event := <-sub.Events():
+			if event.Task != &task || event.Type == EVENT_DESCRIPTION_CHANGED {
+				continue
+			}
+			if event.ParentID != parent.GetTaskID() {
+				t.Errorf("expected parent id %d, got %d", parent.GetTaskID(), event.ParentID)
+			}
+			if event.Type == EVENT_STOPPING && !errors.Is(event.Cause, ErrStopByUser) {
+				t.Errorf("expected stopping cause, got %v", event.Cause)
+			}
+			types = append(types, event.Type)
+		case <-timeout:
+			t.Fatalf("timed out waiting for disposed, got %v", types)
+		}
+	}
+	if expected := []LifecycleEventType{EVENT_ADDED, EVENT_STARTING, EVENT_STARTED, EVENT_STOPPING, EVENT_DISPOSING, EVENT_DISPOSED}; !slices.Equal(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+	if event := <-latest.Events(); event.Value != 2 || latest.Dropped() != 2 {
+		t.Errorf("expected only the latest step to be kept, got %v dropped %d", event.Value, latest.Dropped())
+	}
+}
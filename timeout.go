@@ -0,0 +1,64 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	DeadlineKey      = "deadline"
+	TimeRemainingKey = "timeRemaining"
+)
+
+type (
+	// TimeoutConfig can be passed to AddTask as an option
+	TimeoutConfig struct {
+		Timeout      time.Duration // Deadline of Start, Run and Go counted from each start (0 means no limit)
+		StartTimeout time.Duration // Deadline of Start alone (0 means no limit)
+	}
+	// timeRemaining formats the time left until the deadline when descriptions are read
+	timeRemaining time.Time
+)
+
+var ErrStartTimeout = fmt.Errorf("start %w", ErrTimeout)
+
+func (r timeRemaining) String() string {
+	return max(time.Until(time.Time(r)), 0).Round(time.Millisecond).String()
+}
+
+// SetTimeout stops the task with ErrTimeout when Start, Run and Go together exceed timeout
+func (task *Task) SetTimeout(timeout time.Duration) {
+	task.timeout.Timeout = timeout
+}
+
+// SetStartTimeout stops the task with ErrStartTimeout when Start exceeds timeout
+func (task *Task) SetStartTimeout(timeout time.Duration) {
+	task.timeout.StartTimeout = timeout
+}
+
+// startTimer stops the current run with err after timeout, the timer is dropped once the run ends
+func (task *Task) startTimer(timeout time.Duration, err error) *time.Timer {
+	ctx := task.Context
+	timer := time.AfterFunc(timeout, func() {
+		if ctx.Err() == nil {
+			task.Warn("task timeout", "taskId", task.ID, "timeout", timeout, "reason", err)
+			task.Stop(err)
+		}
+	})
+	context.AfterFunc(ctx, func() {
+		timer.Stop()
+	})
+	return timer
+}
+
+// startDeadline arms the execution deadline of the current run
+func (task *Task) startDeadline() {
+	if task.timeout.Timeout <= 0 {
+		return
+	}
+	deadline := task.StartTime.Add(task.timeout.Timeout)
+	task.SetDescription(DeadlineKey, deadline.Format(time.DateTime))
+	task.SetDescription(TimeRemainingKey, timeRemaining(deadline))
+	task.startTimer(task.timeout.Timeout, ErrTimeout)
+}
@@ -0,0 +1,112 @@
+package task
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type (
+	// Tracer 为任务创建 span，可通过适配器对接 OpenTelemetry 等追踪系统
+	Tracer interface {
+		// StartSpan 在任务启动时调用，ctx 继承自父任务的 context，parent 为父任务的 span（可能为 nil）
+		// 返回的 context 需派生自 ctx，会作为任务 context 的值来源，使子任务和下游调用获得正确的父 span
+		StartSpan(ctx context.Context, task ITask, parent Span) (context.Context, Span)
+	}
+	// Span 任务的一次执行（从启动到销毁），重试和重启会产生新的 span
+	Span interface {
+		SetAttribute(key string, value any)
+		// End 在任务销毁（或启动失败）时调用，reason 为停止原因，failed 表示是否因失败停止
+		End(reason error, failed bool)
+	}
+	// traceContext 包装任务的 context，启动后从 span 所在的 context 取值，取消和截止时间仍由任务 context 决定
+	traceContext struct {
+		context.Context
+		state atomic.Pointer[traceState]
+	}
+	traceState struct {
+		ctx   context.Context
+		span  Span
+		ended atomic.Bool
+	}
+	tracerHolder struct {
+		Tracer
+	}
+	spanKey struct{}
+)
+
+var tracer atomic.Pointer[tracerHolder]
+
+// SetTracer 设置全局 Tracer，传入 nil 关闭追踪，只对之后创建或重置 context 的任务生效
+func SetTracer(t Tracer) {
+	if t == nil {
+		tracer.Store(nil)
+		return
+	}
+	tracer.Store(&tracerHolder{t})
+}
+
+// SpanFromContext 获取 ctx 所属任务的 span，未启用追踪时返回 nil
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+func (c *traceContext) Value(key any) any {
+	if s := c.state.Load(); s != nil {
+		if key == (spanKey{}) {
+			return s.span
+		}
+		return s.ctx.Value(key)
+	}
+	return c.Context.Value(key)
+}
+
+// withTrace 启用追踪时包装任务的 context
+func withTrace(ctx context.Context) context.Context {
+	if tracer.Load() == nil {
+		return ctx
+	}
+	return &traceContext{Context: ctx}
+}
+
+func (task *Task) startSpan() {
+	tc, ok := task.Context.(*traceContext)
+	t := tracer.Load()
+	if !ok || t == nil {
+		return
+	}
+	ctx, span := t.StartSpan(tc.Context, task.handler, SpanFromContext(task.parentCtx))
+	if span == nil {
+		return
+	}
+	span.SetAttribute("task.id", task.ID)
+	span.SetAttribute("task.type", task.handler.GetTaskType())
+	span.SetAttribute("task.ownerType", task.GetOwnerType())
+	span.SetAttribute("task.level", task.level)
+	span.SetAttribute("task.startReason", task.StartReason)
+	if task.parent != nil {
+		span.SetAttribute("task.parentId", task.parent.ID)
+	}
+	task.description.Range(func(key, value any) bool {
+		span.SetAttribute(key.(string), value)
+		return true
+	})
+	tc.state.Store(&traceState{ctx: ctx, span: span})
+}
+
+// endSpan 以描述信息的最终值作为属性结束 span
+func (task *Task) endSpan(reason error) {
+	tc, ok := task.Context.(*traceContext)
+	if !ok {
+		return
+	}
+	s := tc.state.Load()
+	if s == nil || s.ended.Swap(true) {
+		return
+	}
+	task.description.Range(func(key, value any) bool {
+		s.span.SetAttribute(key.(string), value)
+		return true
+	})
+	s.span.End(reason, isFailure(reason))
+}
@@ -0,0 +1,210 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Future 携带类型化结果的异步操作
+type Future[T any] struct {
+	done      chan struct{}
+	mux       sync.Mutex
+	settled   bool
+	value     T
+	err       error
+	callbacks []func()
+	ctx       context.Context
+	stop      func() bool
+}
+
+// NewFuture 创建一个新的 Future
+func NewFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// NewFutureWithContext 创建一个新的 Future，ctx 结束时以 ctx 的错误原因拒绝
+func NewFutureWithContext[T any](ctx context.Context) *Future[T] {
+	f := NewFuture[T]()
+	f.ctx = ctx
+	stop := context.AfterFunc(ctx, func() {
+		f.Reject(context.Cause(ctx))
+	})
+	f.mux.Lock()
+	f.stop = stop
+	f.mux.Unlock()
+	return f
+}
+
+// Resolve 以 value 完成 Future，已完成时返回 false
+func (f *Future[T]) Resolve(value T) bool {
+	return f.Complete(value, nil)
+}
+
+// Reject 以 err 拒绝 Future，已完成时返回 false
+func (f *Future[T]) Reject(err error) bool {
+	var zero T
+	return f.Complete(zero, err)
+}
+
+// Complete 以 value 和 err 完成 Future，err 为 nil 时视为 Resolve，已完成时返回 false
+// 绑定的 ctx 已结束时总是以 ctx 的错误原因拒绝
+func (f *Future[T]) Complete(value T, err error) bool {
+	f.mux.Lock()
+	if f.settled {
+		f.mux.Unlock()
+		return false
+	}
+	if f.ctx != nil {
+		if cause := context.Cause(f.ctx); cause != nil {
+			var zero T
+			value, err = zero, cause
+		}
+	}
+	f.settled, f.value, f.err = true, value, err
+	callbacks, stop := f.callbacks, f.stop
+	f.callbacks = nil
+	close(f.done)
+	f.mux.Unlock()
+	if stop != nil {
+		stop()
+	}
+	for _, callback := range callbacks {
+		callback()
+	}
+	return true
+}
+
+// OnComplete 注册完成回调，已完成时立即调用
+func (f *Future[T]) OnComplete(callback func(T, error)) {
+	f.mux.Lock()
+	if !f.settled {
+		f.callbacks = append(f.callbacks, func() {
+			callback(f.value, f.err)
+		})
+		f.mux.Unlock()
+		return
+	}
+	f.mux.Unlock()
+	callback(f.value, f.err)
+}
+
+// Done 返回 Future 完成时关闭的通道
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await 等待 Future 完成，ctx 先结束时返回 ctx 的错误原因
+func (f *Future[T]) Await(ctx context.Context) (value T, err error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return value, context.Cause(ctx)
+	}
+}
+
+// Wait 等待 Future 完成
+func (f *Future[T]) Wait() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// IsResolved 检查 Future 是否已成功完成
+func (f *Future[T]) IsResolved() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.settled && f.err == nil
+}
+
+// IsRejected 检查 Future 是否已被拒绝
+func (f *Future[T]) IsRejected() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.settled && f.err != nil
+}
+
+// All 所有 Future 成功后按顺序返回全部结果，任意一个失败时立即拒绝
+func All[T any](futures ...*Future[T]) *Future[[]T] {
+	result := NewFuture[[]T]()
+	values := make([]T, len(futures))
+	var mux sync.Mutex
+	remain := len(futures)
+	if remain == 0 {
+		result.Resolve(values)
+	}
+	for i, f := range futures {
+		f.OnComplete(func(value T, err error) {
+			if err != nil {
+				result.Reject(err)
+				return
+			}
+			mux.Lock()
+			values[i] = value
+			remain--
+			last := remain == 0
+			mux.Unlock()
+			if last {
+				result.Resolve(values)
+			}
+		})
+	}
+	return result
+}
+
+// Any 返回第一个成功的结果，全部失败时以合并的错误拒绝
+func Any[T any](futures ...*Future[T]) *Future[T] {
+	result := NewFuture[T]()
+	errs := make([]error, len(futures))
+	var mux sync.Mutex
+	remain := len(futures)
+	if remain == 0 {
+		result.Reject(ErrNoFuture)
+	}
+	for i, f := range futures {
+		f.OnComplete(func(value T, err error) {
+			if err == nil {
+				result.Resolve(value)
+				return
+			}
+			mux.Lock()
+			errs[i] = err
+			remain--
+			last := remain == 0
+			mux.Unlock()
+			if last {
+				result.Reject(errors.Join(errs...))
+			}
+		})
+	}
+	return result
+}
+
+// Race 返回第一个完成的 Future 的结果，无论成功或失败
+func Race[T any](futures ...*Future[T]) *Future[T] {
+	result := NewFuture[T]()
+	if len(futures) == 0 {
+		result.Reject(ErrNoFuture)
+	}
+	for _, f := range futures {
+		f.OnComplete(func(value T, err error) {
+			result.Complete(value, err)
+		})
+	}
+	return result
+}
+
+// Then 在 f 成功后以其结果调用 next，f 失败时直接传递错误
+func Then[T, R any](f *Future[T], next func(T) (R, error)) *Future[R] {
+	result := NewFuture[R]()
+	f.OnComplete(func(value T, err error) {
+		if err != nil {
+			result.Reject(err)
+			return
+		}
+		result.Complete(next(value))
+	})
+	return result
+}
+
+var ErrNoFuture = errors.New("no future")
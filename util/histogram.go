@@ -0,0 +1,91 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDurationBuckets 默认的时长分桶上限
+var DefaultDurationBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// HistogramBucket 分桶统计，Le 为 0 表示 +Inf，Count 为累计次数
+type HistogramBucket struct {
+	Le    time.Duration
+	Count uint64
+}
+
+// Histogram 并发安全的时长分布统计
+type Histogram struct {
+	buckets []time.Duration
+	counts  []atomic.Uint64 // 最后一个为 +Inf
+	count   atomic.Uint64
+	sum     atomic.Int64
+}
+
+// NewHistogram 创建时长分布统计，buckets 为空时使用 DefaultDurationBuckets
+func NewHistogram(buckets ...time.Duration) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+}
+
+// Observe 记录一次时长
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.buckets) && d > h.buckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Count 记录的总次数
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum 记录的总时长
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(h.sum.Load())
+}
+
+// Buckets 获取累计分桶统计
+func (h *Histogram) Buckets() []HistogramBucket {
+	result := make([]HistogramBucket, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		result[i].Count = total
+		if i < len(h.buckets) {
+			result[i].Le = h.buckets[i]
+		}
+	}
+	return result
+}
+
+func (h *Histogram) String() string {
+	var b strings.Builder
+	for _, bucket := range h.Buckets() {
+		if bucket.Le == 0 {
+			fmt.Fprintf(&b, "+Inf:%d", bucket.Count)
+		} else {
+			fmt.Fprintf(&b, "≤%s:%d ", bucket.Le, bucket.Count)
+		}
+	}
+	if count := h.Count(); count > 0 {
+		fmt.Fprintf(&b, " avg:%s", (h.Sum() / time.Duration(count)).Round(time.Microsecond))
+	}
+	return b.String()
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
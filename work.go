@@ -27,7 +27,7 @@ func (c *WorkCollection[K, T]) active(value any) (t T, ok bool) {
 		return
 	}
 	s := t.GetState()
-	ok = s >= TASK_STATE_STARTED && s < TASK_STATE_DISPOSING
+	ok = s >= TASK_STATE_STARTED && s < TASK_STATE_DISPOSING || s == TASK_STATE_PAUSED
 	if ok {
 		return t, true
 	}
@@ -35,6 +35,17 @@ func (c *WorkCollection[K, T]) active(value any) (t T, ok bool) {
 	return zero, false
 }
 
+// Replace 用 t 替换键相同的任务，order 决定新旧任务的启停顺序以及键映射的切换时机
+// 键不存在时新任务以 ErrTaskNotFound 拒绝，旧任务以 ErrReplaced 停止
+func (c *WorkCollection[K, T]) Replace(t T, order ReplaceOrder, opt ...any) *Task {
+	return c.replaceTask(t, order, false, opt...)
+}
+
+// Upsert 键不存在时添加 t，存在时按 order 替换
+func (c *WorkCollection[K, T]) Upsert(t T, order ReplaceOrder, opt ...any) *Task {
+	return c.replaceTask(t, order, true, opt...)
+}
+
 // Find 查找符合条件的任务
 func (c *WorkCollection[K, T]) Find(f func(T) bool) (item T, ok bool) {
 	c.Range(func(v T) bool {